@@ -0,0 +1,402 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/activation"
+	"github.com/chenwes/licensemodule/internal/audit"
+	"github.com/chenwes/licensemodule/internal/catalog"
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/store"
+)
+
+// MaxActivationCodes 单次请求最多创建的激活码数量
+const MaxActivationCodes = 1000
+
+// CreateActivationCodesRequest 创建激活码的请求参数
+type CreateActivationCodesRequest struct {
+	AppID          string   `json:"app_id"`
+	Features       []string `json:"features,omitempty"`
+	Edition        string   `json:"edition,omitempty"` // 产品目录中的版本，创建时展开为该版本的功能和有效期
+	Days           int      `json:"days"`              // 激活后License的有效期，为0时使用默认天数
+	MaxActivations int      `json:"max_activations"`   // 同时激活的机器数量上限，为0时为1
+	Count          int      `json:"count"`             // 创建的激活码数量，为0时为1
+}
+
+// ActivationCodesResponse 激活码列表响应
+type ActivationCodesResponse struct {
+	Success bool                    `json:"success"`
+	Codes   []*store.ActivationCode `json:"codes"`
+}
+
+// ActivateRequest 激活和反激活的请求参数，MachineID 为客户端 GetMachineID 的结果
+type ActivateRequest struct {
+	Code      string `json:"code"`
+	MachineID string `json:"machine_id"`
+}
+
+// 创建激活码接口
+func (s *Server) HandleCreateActivationCodes(w http.ResponseWriter, r *http.Request) {
+	var req CreateActivationCodesRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	codes, err := s.createActivationCodes(r.Context(), req, r.RemoteAddr)
+	if err != nil {
+		sendRequestError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, ActivationCodesResponse{Success: true, Codes: codes})
+}
+
+// 列出激活码接口，可以通过 app_id 参数过滤
+func (s *Server) HandleListActivationCodes(w http.ResponseWriter, r *http.Request) {
+	if s.Store == nil {
+		sendError(w, errStoreNotConfigured.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	all, err := s.Store.ListActivationCodes()
+	if err != nil {
+		sendError(w, "Failed to list activation codes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	appID := r.URL.Query().Get("app_id")
+	codes := []*store.ActivationCode{}
+	for _, c := range all {
+		if appID == "" || c.AppID == appID {
+			codes = append(codes, c)
+		}
+	}
+	sendJSON(w, http.StatusOK, ActivationCodesResponse{Success: true, Codes: codes})
+}
+
+// 激活接口，使用激活码换取绑定当前机器的License，默认以文件下载返回
+func (s *Server) HandleActivate(w http.ResponseWriter, r *http.Request) {
+	var req ActivateRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	lic, err := s.activate(r.Context(), req, r.RemoteAddr)
+	if err != nil {
+		sendRequestError(w, err)
+		return
+	}
+	s.sendLicense(w, r, lic, responseFile, false)
+}
+
+// 反激活接口，释放机器占用的激活数量，并吊销该机器的License
+func (s *Server) HandleDeactivate(w http.ResponseWriter, r *http.Request) {
+	var req ActivateRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := s.deactivate(r.Context(), req, r.RemoteAddr); err != nil {
+		sendRequestError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, Response{Success: true, Data: "License deactivated"})
+}
+
+// 离线激活接口，请求体为离线机器生成的激活请求文件或其紧凑编码，
+// 有效期通过 days 参数指定，返回格式同生成接口
+func (s *Server) HandleOfflineActivation(w http.ResponseWriter, r *http.Request) {
+	s.limitBody(w, r)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			sendError(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var days int
+	if v := r.URL.Query().Get("days"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil {
+			sendError(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+	}
+
+	lic, err := s.activateOffline(r.Context(), data, days, r.RemoteAddr)
+	if err != nil {
+		sendRequestError(w, err)
+		return
+	}
+	s.sendLicense(w, r, lic, responseFile, false)
+}
+
+// 校验离线激活请求的签名和硬件信息，为请求中的机器、应用和功能签发License
+func (s *Server) activateOffline(ctx context.Context, data []byte, days int, remoteAddr string) (*license.License, error) {
+	req, err := license.ParseActivationRequest(data)
+	if err != nil {
+		return nil, newRequestError(http.StatusBadRequest, err.Error())
+	}
+	if err := req.Verify(); err != nil {
+		return nil, newRequestError(http.StatusBadRequest, err.Error())
+	}
+
+	return s.issueLicense(ctx, audit.ActionGenerate, GenerateLicenseRequest{
+		MachineID: req.MachineID,
+		AppID:     req.AppID,
+		Days:      days,
+		Features:  req.Features,
+	}, map[string]string{
+		"remote_addr":   remoteAddr,
+		"request_nonce": req.Nonce,
+	})
+}
+
+// 创建激活码，有效期和应用ID的限制与直接签发License相同
+func (s *Server) createActivationCodes(ctx context.Context, req CreateActivationCodesRequest, remoteAddr string) ([]*store.ActivationCode, error) {
+	if s.Store == nil {
+		return nil, newRequestError(http.StatusServiceUnavailable, errStoreNotConfigured.Error())
+	}
+
+	// 验证请求参数
+	if req.AppID == "" {
+		return nil, newRequestError(http.StatusBadRequest, "App ID is required")
+	}
+	if req.Edition != "" {
+		ent, err := s.expandEdition(req.AppID, req.Edition, catalog.Entitlements{Features: req.Features, Days: req.Days})
+		if err != nil {
+			return nil, err
+		}
+		req.Features, req.Days = ent.Features, ent.Days
+	}
+	if req.Days == 0 {
+		req.Days = s.DefaultDays
+	}
+	if req.Days <= 0 {
+		return nil, newRequestError(http.StatusBadRequest, "Days must be positive")
+	}
+	if req.MaxActivations == 0 {
+		req.MaxActivations = 1
+	}
+	if req.MaxActivations < 0 {
+		return nil, newRequestError(http.StatusBadRequest, "Max activations must be positive")
+	}
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Count < 0 || req.Count > MaxActivationCodes {
+		return nil, newRequestError(http.StatusBadRequest, fmt.Sprintf("Count must be between 1 and %d", MaxActivationCodes))
+	}
+	if !s.appAllowed(req.AppID) {
+		return nil, newRequestError(http.StatusForbidden, "App ID is not allowed")
+	}
+	if maxDays := s.maxDays(req.AppID); maxDays > 0 && req.Days > maxDays {
+		return nil, newRequestError(http.StatusBadRequest, fmt.Sprintf("Days cannot exceed %d for this app", maxDays))
+	}
+
+	codes := make([]*store.ActivationCode, 0, req.Count)
+	for i := 0; i < req.Count; i++ {
+		code, err := activation.NewCode()
+		if err != nil {
+			return nil, newRequestError(http.StatusInternalServerError, "Failed to generate activation code: "+err.Error())
+		}
+		c := &store.ActivationCode{
+			Code:           code,
+			AppID:          req.AppID,
+			Features:       req.Features,
+			Edition:        req.Edition,
+			Days:           req.Days,
+			MaxActivations: req.MaxActivations,
+			CreatedAt:      time.Now().UTC(),
+			CreatedBy:      clientName(ctx),
+		}
+
+		// 审计日志中只记录激活码ID，不记录激活码本身
+		if s.Audit != nil {
+			details := map[string]string{
+				"activation_id":   activation.ID(code),
+				"days":            strconv.Itoa(c.Days),
+				"max_activations": strconv.Itoa(c.MaxActivations),
+				"remote_addr":     remoteAddr,
+			}
+			if c.Edition != "" {
+				details["edition"] = c.Edition
+			}
+			err := s.Audit.Append(audit.Event{
+				Action:   audit.ActionCreateCode,
+				Actor:    actorName(ctx),
+				AppID:    c.AppID,
+				Features: c.Features,
+				Details:  details,
+			})
+			if err != nil {
+				s.contextLogger(ctx).Error("failed to write audit log", "error", err)
+				return nil, newRequestError(http.StatusInternalServerError, "Failed to write audit log: "+err.Error())
+			}
+		}
+
+		if err := s.Store.PutActivationCode(c); err != nil {
+			return nil, newRequestError(http.StatusInternalServerError, "Failed to store activation code: "+err.Error())
+		}
+		codes = append(codes, c)
+	}
+
+	s.contextLogger(ctx).Info("activation codes created",
+		"app_id", req.AppID, "count", len(codes), "client", clientName(ctx))
+	return codes, nil
+}
+
+// 使用激活码为机器签发License。已激活的机器再次激活时重新签发License并吊销之前的License，
+// 不占用新的激活数量。License的有效期为 ActivationDays，客户端定期重新激活换取新License，
+// 到期时间不超过首次激活时间加上激活码的有效期
+func (s *Server) activate(ctx context.Context, req ActivateRequest, remoteAddr string) (*license.License, error) {
+	if s.Store == nil {
+		return nil, newRequestError(http.StatusServiceUnavailable, errStoreNotConfigured.Error())
+	}
+	if req.Code == "" {
+		return nil, newRequestError(http.StatusBadRequest, "Activation code is required")
+	}
+	if req.MachineID == "" {
+		return nil, newRequestError(http.StatusBadRequest, "Machine ID is required")
+	}
+
+	var lic *license.License
+	var replaced string
+	_, err := s.Store.UpdateActivationCode(req.Code, func(c *store.ActivationCode) error {
+		existing := c.ActiveActivation(req.MachineID)
+		if existing == nil && c.ActiveCount() >= c.MaxActivations {
+			return newRequestError(http.StatusConflict,
+				fmt.Sprintf("Activation limit reached, the code is active on %d machines", c.ActiveCount()))
+		}
+
+		// 激活码的有效期从首次激活开始计算，重新激活不会延长
+		activatedAt := time.Now().UTC()
+		if existing != nil {
+			activatedAt = existing.ActivatedAt
+		}
+		notAfter := activatedAt.AddDate(0, 0, c.Days)
+		if !time.Now().Before(notAfter) {
+			return newRequestError(http.StatusConflict, "Activation has expired")
+		}
+		days := c.Days
+		if s.ActivationDays > 0 && s.ActivationDays < days {
+			days = s.ActivationDays
+		}
+
+		var err error
+		lic, err = s.issueLicense(ctx, audit.ActionActivate, GenerateLicenseRequest{
+			MachineID: req.MachineID,
+			AppID:     c.AppID,
+			Days:      days,
+			Features:  c.Features,
+			Edition:   c.Edition,
+			notAfter:  notAfter,
+		}, map[string]string{
+			"activation_id": c.ID,
+			"remote_addr":   remoteAddr,
+		})
+		if err != nil {
+			return err
+		}
+
+		if existing != nil {
+			replaced = existing.Serial
+			existing.Serial = lic.Serial
+			return nil
+		}
+		c.Activations = append(c.Activations, &store.Activation{
+			MachineID:   req.MachineID,
+			Serial:      lic.Serial,
+			ActivatedAt: activatedAt,
+		})
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newRequestError(http.StatusNotFound, "Activation code not found")
+	}
+	if err != nil {
+		// License已签发但激活记录没有保存时吊销它，否则它不占用激活数量
+		if lic != nil {
+			if _, revokeErr := s.revokeLicense(ctx, lic.Serial, "activation not recorded", remoteAddr); revokeErr != nil {
+				s.contextLogger(ctx).Error("failed to revoke unrecorded activation", "serial", lic.Serial, "error", revokeErr)
+			}
+		}
+		var reqErr *requestError
+		if !errors.As(err, &reqErr) {
+			err = newRequestError(http.StatusInternalServerError, "Failed to record activation: "+err.Error())
+		}
+		return nil, err
+	}
+
+	// 同一机器只保留最新签发的License有效，反激活时才能完整释放
+	if replaced != "" {
+		if _, err := s.Store.Revoke(replaced, actorName(ctx), "reissued"); err != nil {
+			s.contextLogger(ctx).Error("failed to revoke replaced license", "serial", replaced, "error", err)
+		}
+	}
+
+	s.contextLogger(ctx).Info("license activated",
+		"activation_id", activation.ID(req.Code), "serial", lic.Serial, "machine_id", req.MachineID)
+	return lic, nil
+}
+
+// 反激活机器，释放激活数量并吊销该机器的License，使在线验证失败
+func (s *Server) deactivate(ctx context.Context, req ActivateRequest, remoteAddr string) error {
+	if s.Store == nil {
+		return newRequestError(http.StatusServiceUnavailable, errStoreNotConfigured.Error())
+	}
+	if req.Code == "" {
+		return newRequestError(http.StatusBadRequest, "Activation code is required")
+	}
+	if req.MachineID == "" {
+		return newRequestError(http.StatusBadRequest, "Machine ID is required")
+	}
+
+	var serial string
+	_, err := s.Store.UpdateActivationCode(req.Code, func(c *store.ActivationCode) error {
+		act := c.ActiveActivation(req.MachineID)
+		if act == nil {
+			return newRequestError(http.StatusNotFound, "Machine is not activated with this code")
+		}
+
+		rec, err := s.Store.GetRecord(act.Serial)
+		if err != nil {
+			return newRequestError(http.StatusInternalServerError, "Failed to load license: "+err.Error())
+		}
+		err = s.audit(ctx, audit.ActionDeactivate, rec.License, map[string]string{
+			"activation_id": c.ID,
+			"remote_addr":   remoteAddr,
+		})
+		if err != nil {
+			s.contextLogger(ctx).Error("failed to write audit log", "serial", act.Serial, "error", err)
+			return newRequestError(http.StatusInternalServerError, "Failed to write audit log: "+err.Error())
+		}
+
+		now := time.Now().UTC()
+		act.DeactivatedAt = &now
+		serial = act.Serial
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return newRequestError(http.StatusNotFound, "Activation code not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Store.Revoke(serial, actorName(ctx), "deactivated"); err != nil {
+		return newRequestError(http.StatusInternalServerError, "Failed to revoke license: "+err.Error())
+	}
+
+	s.contextLogger(ctx).Info("license deactivated",
+		"activation_id", activation.ID(req.Code), "serial", serial, "machine_id", req.MachineID)
+	return nil
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/store"
+)
+
+// 激活签发的License只有 ActivationDays 天有效期，重新激活不能超出激活码的有效期
+func TestActivateShortLived(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.ActivationDays = 7
+	ctx := context.Background()
+
+	codes, err := s.createActivationCodes(ctx, CreateActivationCodesRequest{AppID: "app", Days: 10}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := ActivateRequest{Code: codes[0].Code, MachineID: "machine"}
+	lic, err := s.activate(ctx, req, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(lic.ExpiryDate); d > 7*24*time.Hour {
+		t.Errorf("activated license expires in %s, want at most 7 days", d)
+	}
+
+	// 首次激活在9天前，重新激活的License在激活码的有效期结束时到期
+	activatedAt := time.Now().UTC().AddDate(0, 0, -9)
+	_, err = s.Store.UpdateActivationCode(req.Code, func(c *store.ActivationCode) error {
+		c.Activations[0].ActivatedAt = activatedAt
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lic, err = s.activate(ctx, req, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end := activatedAt.AddDate(0, 0, 10); !lic.ExpiryDate.Equal(end) {
+		t.Errorf("reactivated license expires at %s, want %s", lic.ExpiryDate, end)
+	}
+
+	_, err = s.Store.UpdateActivationCode(req.Code, func(c *store.ActivationCode) error {
+		c.Activations[0].ActivatedAt = activatedAt.AddDate(0, 0, -1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reqErr *requestError
+	if _, err := s.activate(ctx, req, ""); !errors.As(err, &reqErr) || reqErr.Status != http.StatusConflict {
+		t.Errorf("activation after the code expired: %v, want status %d", err, http.StatusConflict)
+	}
+}
+
+// 服务端只保存激活码的哈希，列表中只返回激活码ID
+func TestActivationCodeNotStored(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+
+	codes, err := s.createActivationCodes(ctx, CreateActivationCodesRequest{AppID: "app", Days: 10}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := codes[0].Code
+	if _, err := s.activate(ctx, ActivateRequest{Code: code, MachineID: "machine"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.Store.Dir(), "activations", "*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("activation files %v: %v", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), code) {
+		t.Errorf("activation file contains the code: %s", data)
+	}
+
+	listed, err := s.Store.ListActivationCodes()
+	if err != nil || len(listed) != 1 {
+		t.Fatalf("ListActivationCodes: %v", err)
+	}
+	if listed[0].Code != "" || listed[0].ID != codes[0].ID {
+		t.Errorf("listed code %q with ID %q, want only the ID %q", listed[0].Code, listed[0].ID, codes[0].ID)
+	}
+}
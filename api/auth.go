@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	clientNameKey contextKey = iota
+	requestIDKey
+)
+
+// 校验客户端身份，支持已验证的客户端证书（mTLS），
+// 或通过 X-API-Key、Authorization: Bearer 头传递的API Key
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.AuthEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		name, ok := clientCertName(r)
+		if !ok {
+			name, ok = s.lookupAPIKey(apiKeyFromRequest(r))
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			sendError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), clientNameKey, name)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// 查找API Key对应的客户端名称，使用常量时间比较
+func (s *Server) lookupAPIKey(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+
+	var name string
+	found := false
+	for k, n := range s.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			name = n
+			found = true
+		}
+	}
+	return name, found
+}
+
+// 取出已验证的客户端证书名称，TLS握手时已经用客户端CA校验过证书链
+func clientCertName(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	return "cert:" + cert.Subject.CommonName, true
+}
+
+// 从请求头中取出API Key
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// ClientName 返回通过认证的客户端名称，未认证时返回空字符串
+func ClientName(r *http.Request) string {
+	return clientName(r.Context())
+}
+
+// 从 context 中取出客户端名称，HTTP 和 gRPC 接口共用
+func clientName(ctx context.Context) string {
+	name, _ := ctx.Value(clientNameKey).(string)
+	return name
+}
@@ -0,0 +1,415 @@
+package api
+
+//go:generate buf generate ../proto --template ../proto/buf.gen.yaml -o ../proto
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/audit"
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/metrics"
+	"github.com/chenwes/licensemodule/internal/store"
+	"github.com/chenwes/licensemodule/pkg/utils"
+	licensev1 "github.com/chenwes/licensemodule/proto/license/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// 需要认证并受限流的 gRPC 方法，与 HTTP 的签发接口对应
+var grpcIssuingMethods = map[string]bool{
+	licensev1.LicenseService_Generate_FullMethodName: true,
+	licensev1.LicenseService_Renew_FullMethodName:    true,
+	licensev1.LicenseService_Revoke_FullMethodName:   true,
+	licensev1.LicenseService_List_FullMethodName:     true,
+}
+
+// 无需认证但按IP限流的 gRPC 方法，与 HTTP 中 Throttled 的接口对应
+var grpcThrottledMethods = map[string]bool{
+	licensev1.LicenseService_Verify_FullMethodName: true,
+}
+
+// GRPCServer 返回注册了 LicenseService 和服务反射的 gRPC 服务，
+// opts 可以传入 TLS 凭据等选项。返回的服务可以在任意 net.Listener（包括 bufconn）上运行
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(s.grpcLogging, s.grpcAuth))
+	gs := grpc.NewServer(opts...)
+	licensev1.RegisterLicenseServiceServer(gs, &grpcService{server: s})
+	reflection.Register(gs)
+	return gs
+}
+
+// grpcService LicenseService 的实现，与 HTTP 接口共用 Server 上的License操作
+type grpcService struct {
+	licensev1.UnimplementedLicenseServiceServer
+	server *Server
+}
+
+// 生成License
+func (g *grpcService) Generate(ctx context.Context, req *licensev1.GenerateRequest) (*licensev1.GenerateResponse, error) {
+	lic, err := g.server.issueLicense(ctx, audit.ActionGenerate, GenerateLicenseRequest{
+		MachineID: req.GetMachineId(),
+		AppID:     req.GetAppId(),
+		Days:      int(req.GetDays()),
+		Features:  req.GetFeatures(),
+		Seats:     int(req.GetSeats()),
+		Edition:   req.GetEdition(),
+		Limits: license.Limits{
+			MaxCores:     int(req.GetMaxCores()),
+			MaxUsers:     int(req.GetMaxUsers()),
+			MaxInstances: int(req.GetMaxInstances()),
+		},
+		AppIDs:      req.GetAppIds(),
+		AppFeatures: appFeatures(req.GetAppFeatures()),
+		MinVersion:  req.GetMinVersion(),
+		MaxVersion:  req.GetMaxVersion(),
+		Customer: license.Customer{
+			CustomerName: req.GetCustomerName(),
+			CustomerID:   req.GetCustomerId(),
+			Contract:     req.GetContract(),
+			ContactEmail: req.GetContactEmail(),
+			Metadata:     req.GetMetadata(),
+		},
+		Binding: license.Binding{
+			BindingType: req.GetBinding(),
+			Hostnames:   req.GetHostnames(),
+			Networks:    req.GetNetworks(),
+		},
+		Encrypt: req.GetEncrypt(),
+	}, map[string]string{"remote_addr": peerAddr(ctx)})
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	data, err := g.server.encodeLicense(lic, req.GetEncrypt())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to encode license: %v", err)
+	}
+	return &licensev1.GenerateResponse{License: licenseProto(lic), Data: data}, nil
+}
+
+// 续期License
+func (g *grpcService) Renew(ctx context.Context, req *licensev1.RenewRequest) (*licensev1.RenewResponse, error) {
+	renewReq := RenewLicenseRequest{
+		License:  req.GetLicense(),
+		Days:     int(req.GetDays()),
+		Features: req.GetFeatures(),
+		Encrypt:  req.GetEncrypt() || license.IsEncrypted(req.GetLicense()),
+	}
+	lic, err := g.server.renewLicense(ctx, renewReq, peerAddr(ctx))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	data, err := g.server.encodeLicense(lic, renewReq.Encrypt)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to encode license: %v", err)
+	}
+	return &licensev1.RenewResponse{License: licenseProto(lic), Data: data}, nil
+}
+
+// 验证License，验证失败不作为错误返回
+func (g *grpcService) Verify(ctx context.Context, req *licensev1.VerifyRequest) (*licensev1.VerifyResponse, error) {
+	if len(req.GetLicense()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "License is required")
+	}
+	if req.GetMachineId() == "" && req.GetHostname() == "" && len(req.GetIps()) == 0 && !isUnbound(req.GetLicense()) {
+		return nil, status.Error(codes.InvalidArgument, "Machine ID is required")
+	}
+
+	verifyReq := &VerifyLicenseRequest{
+		License:    req.GetLicense(),
+		MachineID:  req.GetMachineId(),
+		AppID:      req.GetAppId(),
+		AppVersion: req.GetAppVersion(),
+		Hostname:   req.GetHostname(),
+		IPs:        req.GetIps(),
+	}
+	if u := req.GetUsage(); u != nil {
+		verifyReq.Usage = &license.Usage{Cores: int(u.GetCores()), Users: int(u.GetUsers()), Instances: int(u.GetInstances())}
+	}
+	lic, err := g.server.verifyLicense(ctx, verifyReq)
+	if err != nil {
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			return nil, grpcError(ctx, err)
+		}
+		return &licensev1.VerifyResponse{Valid: false, Code: metrics.VerifyResult(err), Message: err.Error()}, nil
+	}
+	return &licensev1.VerifyResponse{Valid: true, License: licenseProto(lic)}, nil
+}
+
+// 获取服务所在机器的ID
+func (g *grpcService) GetMachineID(ctx context.Context, req *licensev1.GetMachineIDRequest) (*licensev1.GetMachineIDResponse, error) {
+	var id string
+	var err error
+
+	if req.GetContainer() {
+		id, err = utils.GetContainerizedMachineID()
+	} else {
+		id, err = utils.GetMachineID()
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &licensev1.GetMachineIDResponse{MachineId: id}, nil
+}
+
+// 吊销License
+func (g *grpcService) Revoke(ctx context.Context, req *licensev1.RevokeRequest) (*licensev1.RevokeResponse, error) {
+	rec, err := g.server.revokeLicense(ctx, req.GetSerial(), req.GetReason(), peerAddr(ctx))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &licensev1.RevokeResponse{Record: recordProto(rec)}, nil
+}
+
+// 列出已签发的License
+func (g *grpcService) List(ctx context.Context, req *licensev1.ListRequest) (*licensev1.ListResponse, error) {
+	records, err := g.server.listLicenses(listFilter{
+		AppID:          req.GetAppId(),
+		MachineID:      req.GetMachineId(),
+		IncludeRevoked: req.GetIncludeRevoked(),
+		Query: store.Query{
+			Customer: req.GetCustomer(),
+			Contract: req.GetContract(),
+			Email:    req.GetEmail(),
+			Metadata: req.GetMetadata(),
+			Text:     req.GetText(),
+		},
+	})
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	resp := &licensev1.ListResponse{}
+	for _, rec := range records {
+		resp.Records = append(resp.Records, recordProto(rec))
+	}
+	return resp, nil
+}
+
+// 分配请求ID并记录访问日志，客户端可以通过 x-request-id 元数据传入请求ID
+func (s *Server) grpcLogging(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+
+	id := metadataValue(ctx, strings.ToLower(RequestIDHeader))
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(RequestIDHeader), id))
+	ctx = context.WithValue(ctx, requestIDKey, id)
+
+	resp, err := handler(ctx, req)
+
+	s.logger().LogAttrs(ctx, slog.LevelInfo, "request",
+		slog.String("request_id", id),
+		slog.String("method", info.FullMethod),
+		slog.String("code", status.Code(err).String()),
+		slog.Duration("duration", time.Since(start)),
+		slog.String("remote_addr", peerAddr(ctx)),
+	)
+	return resp, err
+}
+
+// 校验签发类方法的调用方身份并限流，顺序与 HTTP 接口一致：按IP限流、认证、按客户端限流；
+// 验证等无需认证的方法只按IP限流
+func (s *Server) grpcAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !grpcIssuingMethods[info.FullMethod] && !grpcThrottledMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	if ok, retryAfter := s.IPLimiter.Allow(peerIP(ctx)); !ok {
+		return nil, grpcTooManyRequests(ctx, retryAfter, "Too many requests from this IP")
+	}
+	if !grpcIssuingMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	if s.AuthEnabled {
+		name, ok := grpcCertName(ctx)
+		if !ok {
+			name, ok = s.lookupAPIKey(grpcAPIKey(ctx))
+		}
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+		}
+		ctx = context.WithValue(ctx, clientNameKey, name)
+	}
+
+	if name := clientName(ctx); name != "" {
+		if ok, retryAfter := s.ClientLimiter.Allow(name); !ok {
+			return nil, grpcTooManyRequests(ctx, retryAfter, "Too many requests for this API key")
+		}
+	}
+	return handler(ctx, req)
+}
+
+// 将 requestError 转换为 gRPC 状态
+func grpcError(ctx context.Context, err error) error {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	switch reqErr.Status {
+	case http.StatusBadRequest:
+		return status.Error(codes.InvalidArgument, reqErr.Message)
+	case http.StatusForbidden:
+		return status.Error(codes.PermissionDenied, reqErr.Message)
+	case http.StatusNotFound:
+		return status.Error(codes.NotFound, reqErr.Message)
+	case http.StatusConflict:
+		return status.Error(codes.FailedPrecondition, reqErr.Message)
+	case http.StatusTooManyRequests:
+		return grpcTooManyRequests(ctx, reqErr.RetryAfter, reqErr.Message)
+	case http.StatusServiceUnavailable:
+		return status.Error(codes.Unavailable, reqErr.Message)
+	}
+	return status.Error(codes.Internal, reqErr.Message)
+}
+
+// 返回 ResourceExhausted，并通过 retry-after 元数据告知需要等待的秒数
+func grpcTooManyRequests(ctx context.Context, retryAfter time.Duration, message string) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	grpc.SetTrailer(ctx, metadata.Pairs("retry-after", strconv.Itoa(seconds)))
+	return status.Error(codes.ResourceExhausted, message)
+}
+
+// 取出已验证的客户端证书名称
+func grpcCertName(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return "cert:" + info.State.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+// 从 x-api-key 或 authorization: Bearer 元数据中取出API Key
+func grpcAPIKey(ctx context.Context) string {
+	if key := metadataValue(ctx, "x-api-key"); key != "" {
+		return key
+	}
+	if auth := metadataValue(ctx, "authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// 取出请求元数据中的第一个值
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// 调用方地址
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	return p.Addr.String()
+}
+
+// 调用方IP，地址中没有端口时（例如 bufconn）使用完整地址
+func peerIP(ctx context.Context) string {
+	addr := peerAddr(ctx)
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// 转换为 protobuf 的 License
+func licenseProto(lic *license.License) *licensev1.License {
+	pb := &licensev1.License{
+		Serial:         lic.Serial,
+		MachineId:      lic.MachineID,
+		AppId:          lic.AppID,
+		ExpiryDate:     timestamppb.New(lic.ExpiryDate),
+		Features:       lic.Features,
+		Signature:      lic.Signature,
+		CreationDate:   timestamppb.New(lic.CreationDate),
+		TimeZone:       lic.TimeZone,
+		Seats:          int32(lic.Seats),
+		MaxCores:       int32(lic.MaxCores),
+		MaxUsers:       int32(lic.MaxUsers),
+		MaxInstances:   int32(lic.MaxInstances),
+		Edition:        lic.Edition,
+		PreviousSerial: lic.PreviousSerial,
+		OriginalSerial: lic.OriginalSerial,
+		AppIds:         lic.AppIDs,
+		MinVersion:     lic.MinVersion,
+		MaxVersion:     lic.MaxVersion,
+		CustomerName:   lic.CustomerName,
+		CustomerId:     lic.CustomerID,
+		Contract:       lic.Contract,
+		ContactEmail:   lic.ContactEmail,
+		IssuedBy:       lic.IssuedBy,
+		Metadata:       lic.Metadata,
+		Binding:        lic.BindingType,
+		Hostnames:      lic.Hostnames,
+		Networks:       lic.Networks,
+		KeyId:          lic.KeyID,
+	}
+	if len(lic.AppFeatures) > 0 {
+		pb.AppFeatures = make(map[string]*licensev1.FeatureList, len(lic.AppFeatures))
+		for app, features := range lic.AppFeatures {
+			pb.AppFeatures[app] = &licensev1.FeatureList{Features: features}
+		}
+	}
+	return pb
+}
+
+// 转换 protobuf 中按应用的功能列表
+func appFeatures(pb map[string]*licensev1.FeatureList) map[string][]string {
+	if len(pb) == 0 {
+		return nil
+	}
+	features := make(map[string][]string, len(pb))
+	for app, list := range pb {
+		features[app] = list.GetFeatures()
+	}
+	return features
+}
+
+// 转换为 protobuf 的 LicenseRecord
+func recordProto(rec *store.Record) *licensev1.LicenseRecord {
+	pb := &licensev1.LicenseRecord{
+		License:      licenseProto(rec.License),
+		IssuedBy:     rec.IssuedBy,
+		RevokedBy:    rec.RevokedBy,
+		RevokeReason: rec.RevokeReason,
+	}
+	if rec.RevokedAt != nil {
+		pb.RevokedAt = timestamppb.New(*rec.RevokedAt)
+	}
+	return pb
+}
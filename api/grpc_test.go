@@ -0,0 +1,332 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/audit"
+	"github.com/chenwes/licensemodule/internal/certs"
+	"github.com/chenwes/licensemodule/internal/license"
+	licensev1 "github.com/chenwes/licensemodule/proto/license/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// 在 bufconn 上运行 gRPC 服务，返回连接到它的客户端
+func newGRPCClient(t *testing.T, s *Server, serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption) licensev1.LicenseServiceClient {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	gs := s.GRPCServer(serverOpts...)
+	go gs.Serve(ln)
+	t.Cleanup(gs.Stop)
+
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	dialOpts = append(dialOpts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return ln.DialContext(ctx)
+	}))
+	conn, err := grpc.NewClient("passthrough:///bufnet", dialOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return licensev1.NewLicenseServiceClient(conn)
+}
+
+func TestGRPCService(t *testing.T) {
+	s, _ := newTestServer(t)
+	c := newGRPCClient(t, s, nil)
+	ctx := context.Background()
+
+	gen, err := c.Generate(ctx, &licensev1.GenerateRequest{MachineId: "machine", AppId: "app", Days: 10, Features: []string{"report"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen.GetLicense().GetMachineId() != "machine" || len(gen.GetData()) == 0 {
+		t.Fatalf("generated %v", gen.GetLicense())
+	}
+
+	ver, err := c.Verify(ctx, &licensev1.VerifyRequest{License: gen.GetData(), MachineId: "machine", AppId: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ver.GetValid() {
+		t.Errorf("license invalid: %s %s", ver.GetCode(), ver.GetMessage())
+	}
+
+	if _, err := c.Renew(ctx, &licensev1.RenewRequest{License: gen.GetData(), Days: 10}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Renew(ctx, &licensev1.RenewRequest{License: gen.GetData(), Days: 10})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("second renewal: %v, want %s", err, codes.FailedPrecondition)
+	}
+
+	serial := gen.GetLicense().GetSerial()
+	if _, err := c.Revoke(ctx, &licensev1.RevokeRequest{Serial: serial, Reason: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	ver, err = c.Verify(ctx, &licensev1.VerifyRequest{License: gen.GetData(), MachineId: "machine", AppId: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ver.GetValid() || ver.GetCode() != "revoked" {
+		t.Errorf("revoked license verified with code %q", ver.GetCode())
+	}
+
+	list, err := c.List(ctx, &licensev1.ListRequest{AppId: "app", IncludeRevoked: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.GetRecords()) != 2 || list.GetRecords()[0].GetRevokeReason() != "test" {
+		t.Errorf("listed %v", list.GetRecords())
+	}
+
+	_, err = c.Generate(ctx, &licensev1.GenerateRequest{AppId: "app"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("generate without machine ID: %v, want %s", err, codes.InvalidArgument)
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.AuthEnabled = true
+	s.APIKeys = map[string]string{"secret": "backend"}
+	c := newGRPCClient(t, s, nil)
+
+	req := &licensev1.GenerateRequest{MachineId: "machine", AppId: "app"}
+	if _, err := c.Generate(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("generate without API key: %v, want %s", err, codes.Unauthenticated)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "secret")
+	gen, err := c.Generate(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen.GetLicense().GetIssuedBy() != "backend" {
+		t.Errorf("issued by %q, want the API key name", gen.GetLicense().GetIssuedBy())
+	}
+
+	// 验证接口不需要认证
+	if _, err := c.Verify(context.Background(), &licensev1.VerifyRequest{License: gen.GetData(), MachineId: "machine", AppId: "app"}); err != nil {
+		t.Errorf("verify without API key: %v", err)
+	}
+}
+
+// gRPC 客户端要求通过 ALPN 协商 h2，使用证书热加载的 TLS 配置也必须能连接
+func TestGRPCTLS(t *testing.T) {
+	certPEM, keyPEM := selfSignedCert(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	reloader, err := certs.NewReloader(certFile, keyFile, "", certs.ClientAuthNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	s, _ := newTestServer(t)
+	c := newGRPCClient(t, s,
+		[]grpc.ServerOption{grpc.Creds(credentials.NewTLS(reloader.TLSConfig()))},
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool, ServerName: "localhost"})))
+
+	var p peer.Peer
+	if _, err := c.Generate(context.Background(), &licensev1.GenerateRequest{MachineId: "machine", AppId: "app"}, grpc.Peer(&p)); err != nil {
+		t.Fatalf("generate over TLS: %v", err)
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || info.State.NegotiatedProtocol != "h2" {
+		t.Errorf("negotiated protocol %q, want h2", info.State.NegotiatedProtocol)
+	}
+}
+
+// 生成 localhost 的自签名证书
+func selfSignedCert(t *testing.T) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// 并发续期同一License时只有成功的续期写入审计日志
+func TestGRPCRenewAuditedOnce(t *testing.T) {
+	s, _ := newTestServer(t)
+	auditFile := filepath.Join(t.TempDir(), audit.DefaultFile)
+	auditLog, err := audit.Open(auditFile, audit.DefaultKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Audit = auditLog
+	c := newGRPCClient(t, s, nil)
+	ctx := context.Background()
+
+	gen, err := c.Generate(ctx, &licensev1.GenerateRequest{MachineId: "machine", AppId: "app", Days: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Renew(ctx, &licensev1.RenewRequest{License: gen.GetData(), Days: 10})
+			if err != nil && status.Code(err) != codes.FailedPrecondition {
+				t.Errorf("renew: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewals := bytes.Count(data, []byte(`"action":"renew"`)); renewals != 1 {
+		t.Errorf("%d renewals audited, want 1", renewals)
+	}
+}
+
+// 没有机器ID的License各自记录防回拨时间戳
+func TestGRPCVerifyTimestampPerLicense(t *testing.T) {
+	s, _ := newTestServer(t)
+	c := newGRPCClient(t, s, nil)
+	ctx := context.Background()
+
+	var files []string
+	for _, host := range []string{"a.example.com", "b.example.com"} {
+		gen, err := c.Generate(ctx, &licensev1.GenerateRequest{AppId: "app", Binding: "host", Hostnames: []string{host}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ver, err := c.Verify(ctx, &licensev1.VerifyRequest{License: gen.GetData(), AppId: "app", Hostname: host})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ver.GetValid() {
+			t.Fatalf("%s: %s %s", host, ver.GetCode(), ver.GetMessage())
+		}
+		files = append(files, s.Store.TimestampFile(timestampOwner(&VerifyLicenseRequest{License: gen.GetData()}), "app"))
+	}
+
+	if files[0] == files[1] {
+		t.Error("host bound licenses share a timestamp file")
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("timestamp file not written: %v", err)
+		}
+	}
+}
+
+// 不绑定的License不需要机器ID，但必须上报实例数
+func TestGRPCVerifyUnbound(t *testing.T) {
+	s, _ := newTestServer(t)
+	c := newGRPCClient(t, s, nil)
+	ctx := context.Background()
+
+	gen, err := c.Generate(ctx, &licensev1.GenerateRequest{AppId: "app", Binding: "unbound", MaxInstances: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ver, err := c.Verify(ctx, &licensev1.VerifyRequest{License: gen.GetData(), AppId: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ver.GetValid() {
+		t.Error("unbound license verified without an instance count")
+	}
+	ver, err = c.Verify(ctx, &licensev1.VerifyRequest{License: gen.GetData(), AppId: "app", Usage: &licensev1.Usage{Instances: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ver.GetValid() {
+		t.Errorf("license invalid: %s %s", ver.GetCode(), ver.GetMessage())
+	}
+}
+
+// 签名无效或不是本服务签发的License不会在存储中写入时间戳文件
+func TestGRPCVerifyUnknownLicense(t *testing.T) {
+	s, _ := newTestServer(t)
+	c := newGRPCClient(t, s, nil)
+	ctx := context.Background()
+
+	lic, err := license.NewLicense("machine", "app", 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown, err := lic.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lic.MachineID = "other"
+	forged, err := json.Marshal(lic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"unknown": unknown, "forged": forged} {
+		ver, err := c.Verify(ctx, &licensev1.VerifyRequest{License: data, MachineId: "other", AppId: "app"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ver.GetValid() {
+			t.Errorf("%s license verified", name)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Join(s.Store.Dir(), "timestamps")); len(entries) > 0 {
+		t.Errorf("%d timestamp files written", len(entries))
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/chenwes/licensemodule/internal/license"
+)
+
+// BuildInfo 服务的版本信息，通过 ldflags 在编译时注入
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+type ReadyResponse struct {
+	Status    string            `json:"status"`
+	Version   string            `json:"version"`
+	GitCommit string            `json:"git_commit"`
+	Checks    map[string]string `json:"checks"`
+}
+
+var errStoreNotConfigured = errors.New("store is not configured")
+
+const (
+	statusOK       = "ok"
+	statusNotReady = "not_ready"
+)
+
+// 存活检查接口，进程能够响应即视为存活
+func (s *Server) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, HealthResponse{Status: statusOK})
+}
+
+// 就绪检查接口，检查签名密钥和存储是否可用
+func (s *Server) HandleReady(w http.ResponseWriter, r *http.Request) {
+	resp := ReadyResponse{
+		Status:    statusOK,
+		Version:   s.Build.Version,
+		GitCommit: s.Build.GitCommit,
+		Checks:    make(map[string]string),
+	}
+
+	checks := map[string]func() error{
+		"signing_key": license.CheckSigningKey,
+		"store":       s.pingStore,
+	}
+	for name, check := range checks {
+		if err := check(); err != nil {
+			resp.Status = statusNotReady
+			resp.Checks[name] = err.Error()
+			continue
+		}
+		resp.Checks[name] = statusOK
+	}
+
+	status := http.StatusOK
+	if resp.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+	sendJSON(w, status, resp)
+}
+
+// 检查存储是否可访问
+func (s *Server) pingStore() error {
+	if s.Store == nil {
+		return errStoreNotConfigured
+	}
+	return s.Store.Ping()
+}
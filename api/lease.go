@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/floating"
+	"github.com/chenwes/licensemodule/internal/license"
+)
+
+// LeaseRequest 浮动License租约接口的请求参数，ClientID 为客户端的机器ID
+type LeaseRequest struct {
+	AppID    string `json:"app_id,omitempty"`   // 仅 acquire 使用
+	ClientID string `json:"client_id"`          // 客户端机器ID
+	User     string `json:"user,omitempty"`     // 仅 acquire 使用，可选
+	LeaseID  string `json:"lease_id,omitempty"` // renew、borrow、release 使用
+	Duration string `json:"duration,omitempty"` // 仅 borrow 使用，例如 72h
+}
+
+// LeaseResponse 租约接口的响应
+type LeaseResponse struct {
+	Success bool           `json:"success"`
+	Error   string         `json:"error,omitempty"`
+	Lease   *license.Lease `json:"lease,omitempty"`
+}
+
+// LeaseStatusResponse 浮动License使用情况的响应
+type LeaseStatusResponse struct {
+	Success bool                  `json:"success"`
+	Pools   []floating.PoolStatus `json:"pools"`
+}
+
+// 申请租约接口，占用一个席位
+func (s *Server) HandleAcquireLease(w http.ResponseWriter, r *http.Request) {
+	s.handleLease(w, r, func(req LeaseRequest) (*license.Lease, error) {
+		if req.AppID == "" {
+			return nil, newRequestError(http.StatusBadRequest, "App ID is required")
+		}
+		return s.Floating.Acquire(req.AppID, req.ClientID, req.User)
+	})
+}
+
+// 续约接口，客户端需要在租约到期前定期调用（心跳）
+func (s *Server) HandleRenewLease(w http.ResponseWriter, r *http.Request) {
+	s.handleLease(w, r, func(req LeaseRequest) (*license.Lease, error) {
+		return s.Floating.Renew(req.LeaseID, req.ClientID)
+	})
+}
+
+// 借出接口，延长租约供客户端离线使用
+func (s *Server) HandleBorrowLease(w http.ResponseWriter, r *http.Request) {
+	s.handleLease(w, r, func(req LeaseRequest) (*license.Lease, error) {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			return nil, newRequestError(http.StatusBadRequest, "Invalid duration")
+		}
+		return s.Floating.Borrow(req.LeaseID, req.ClientID, d)
+	})
+}
+
+// 释放租约接口，归还席位
+func (s *Server) HandleReleaseLease(w http.ResponseWriter, r *http.Request) {
+	s.handleLease(w, r, func(req LeaseRequest) (*license.Lease, error) {
+		return nil, s.Floating.Release(req.LeaseID, req.ClientID)
+	})
+}
+
+// 浮动License使用情况接口
+func (s *Server) HandleLeaseStatus(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, LeaseStatusResponse{Success: true, Pools: s.Floating.Status()})
+}
+
+// 解析租约请求，执行操作并返回租约
+func (s *Server) handleLease(w http.ResponseWriter, r *http.Request, op func(LeaseRequest) (*license.Lease, error)) {
+	var req LeaseRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.ClientID == "" {
+		sendError(w, "Client ID is required", http.StatusBadRequest)
+		return
+	}
+
+	lease, err := op(req)
+	if err != nil {
+		s.requestLogger(r).Info("lease request failed", "path", r.URL.Path,
+			"app_id", req.AppID, "client_id", req.ClientID, "lease_id", req.LeaseID, "error", err)
+		sendRequestError(w, leaseError(err))
+		return
+	}
+
+	if lease != nil {
+		s.requestLogger(r).Debug("lease updated", "path", r.URL.Path, "lease_id", lease.ID,
+			"app_id", lease.AppID, "client_id", lease.ClientID, "expires_at", lease.ExpiresAt, "borrowed", lease.Borrowed)
+	} else {
+		s.requestLogger(r).Info("lease released", "lease_id", req.LeaseID, "client_id", req.ClientID)
+	}
+	sendJSON(w, http.StatusOK, LeaseResponse{Success: true, Lease: lease})
+}
+
+// 将浮动License的错误转换为对应的HTTP状态码
+func leaseError(err error) error {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		return err
+	case errors.Is(err, floating.ErrNoLicense), errors.Is(err, floating.ErrLeaseNotFound):
+		return newRequestError(http.StatusNotFound, err.Error())
+	case errors.Is(err, floating.ErrNoSeats):
+		return newRequestError(http.StatusConflict, err.Error())
+	case errors.Is(err, floating.ErrBorrowTooLong):
+		return newRequestError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, license.ErrExpiredLicense):
+		return newRequestError(http.StatusForbidden, "Floating license has expired")
+	}
+	return newRequestError(http.StatusInternalServerError, err.Error())
+}
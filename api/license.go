@@ -0,0 +1,317 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chenwes/licensemodule/internal/audit"
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/metrics"
+	"github.com/chenwes/licensemodule/internal/store"
+)
+
+// responseMode 生成接口的响应格式
+type responseMode int
+
+const (
+	responseFile responseMode = iota // 以 license.dat 文件下载返回
+	responseJSON                     // 以 Response 包装的JSON返回
+)
+
+// 生成License接口，默认以文件下载返回，Accept: application/json 时返回JSON
+func (s *Server) HandleGenerateLicense(w http.ResponseWriter, r *http.Request) {
+	s.generateLicense(responseFile)(w, r)
+}
+
+// 按指定的默认响应格式生成License，客户端可以通过 Accept 头覆盖
+func (s *Server) generateLicense(defaultMode responseMode) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// 解析请求参数
+		var req GenerateLicenseRequest
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+
+		lic, err := s.issueLicense(r.Context(), audit.ActionGenerate, req, map[string]string{"remote_addr": r.RemoteAddr})
+		if err != nil {
+			sendRequestError(w, err)
+			return
+		}
+
+		s.sendLicense(w, r, lic, defaultMode, req.Encrypt)
+	}
+}
+
+// 编码License文件内容，encrypt 为 true 或配置了 EncryptLicenses 时加密
+func (s *Server) encodeLicense(lic *license.License, encrypt bool) ([]byte, error) {
+	if encrypt || s.EncryptLicenses {
+		return lic.EncodeEncrypted()
+	}
+	return lic.Encode()
+}
+
+// 返回License文件，默认响应格式可以通过 Accept 头覆盖
+func (s *Server) sendLicense(w http.ResponseWriter, r *http.Request, lic *license.License, defaultMode responseMode, encrypt bool) {
+	// 在内存中编码License，避免并发请求共用临时文件
+	data, err := s.encodeLicense(lic, encrypt)
+	if err != nil {
+		sendError(w, "Failed to encode license: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if negotiate(r, defaultMode) == responseJSON {
+		sendJSON(w, http.StatusOK, Response{Success: true, Data: string(data)})
+		return
+	}
+
+	// 设置文件下载头
+	disposition := mime.FormatMediaType("attachment", map[string]string{
+		"filename": s.downloadFilename(lic),
+	})
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	// 发送文件
+	http.ServeContent(w, r, "", lic.CreationDate, bytes.NewReader(data))
+}
+
+// 检查应用ID是否在允许列表中。通配模式按字面比较，只有列表中包含该模式本身时才允许
+func (s *Server) appAllowed(appID string) bool {
+	if len(s.AllowedAppIDs) == 0 {
+		return true
+	}
+	for _, id := range s.AllowedAppIDs {
+		if id == appID {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据 Accept 头选择响应格式
+func negotiate(r *http.Request, defaultMode responseMode) responseMode {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			return responseJSON
+		case "application/octet-stream":
+			return responseFile
+		}
+	}
+	return defaultMode
+}
+
+// 根据文件名模板生成下载文件名
+func (s *Server) downloadFilename(lic *license.License) string {
+	pattern := s.FilenamePattern
+	if pattern == "" {
+		pattern = DefaultFilenamePattern
+	}
+
+	name := strings.NewReplacer(
+		"{app}", lic.AppID,
+		"{serial}", lic.Serial,
+	).Replace(pattern)
+
+	// 去掉路径分隔符，防止文件名中包含目录
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// 续期License接口，签发链接到原License的新License，返回格式同生成接口
+func (s *Server) HandleRenewLicense(w http.ResponseWriter, r *http.Request) {
+	var req RenewLicenseRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	// License也可以是字符串形式的文件内容
+	var raw string
+	if err := json.Unmarshal(req.License, &raw); err == nil {
+		req.License = []byte(raw)
+	}
+	req.Encrypt = req.Encrypt || license.IsEncrypted(req.License)
+
+	lic, err := s.renewLicense(r.Context(), req, r.RemoteAddr)
+	if err != nil {
+		sendRequestError(w, err)
+		return
+	}
+	s.sendLicense(w, r, lic, responseFile, req.Encrypt)
+}
+
+// 查询已签发License接口，可以按应用、机器、客户、合同号、邮箱和元数据过滤，
+// 元数据条件以 metadata=key:value 的形式传入，可以重复
+func (s *Server) HandleListLicenses(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := listFilter{
+		AppID:          q.Get("app_id"),
+		MachineID:      q.Get("machine_id"),
+		IncludeRevoked: q.Get("include_revoked") == "true",
+		Query: store.Query{
+			Customer: q.Get("customer"),
+			Contract: q.Get("contract"),
+			Email:    q.Get("email"),
+			Text:     q.Get("q"),
+		},
+	}
+	for _, item := range q["metadata"] {
+		key, value, ok := strings.Cut(item, ":")
+		if !ok || key == "" {
+			sendError(w, "Invalid metadata filter, expected key:value", http.StatusBadRequest)
+			return
+		}
+		if filter.Metadata == nil {
+			filter.Metadata = make(map[string]string)
+		}
+		filter.Metadata[key] = value
+	}
+
+	records, err := s.listLicenses(filter)
+	if err != nil {
+		sendRequestError(w, err)
+		return
+	}
+	if records == nil {
+		records = []*store.Record{}
+	}
+	sendJSON(w, http.StatusOK, LicensesResponse{Success: true, Licenses: records})
+}
+
+// 验证License接口，License内容随请求提交，服务端状态只保存在存储目录中
+func (s *Server) HandleVerifyLicense(w http.ResponseWriter, r *http.Request) {
+	s.limitBody(w, r)
+	req, err := parseVerifyRequest(r)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			sendError(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.verifyLicense(r.Context(), req); err != nil {
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			sendRequestError(w, err)
+			return
+		}
+		sendJSON(w, http.StatusOK, Response{Success: false, Error: err.Error(), Code: metrics.VerifyResult(err)})
+		return
+	}
+
+	sendJSON(w, http.StatusOK, Response{Success: true, Data: "License verified successfully"})
+}
+
+// 解析验证请求，支持JSON、multipart上传 license.dat，以及直接提交 license.dat 内容
+func parseVerifyRequest(r *http.Request) (*VerifyLicenseRequest, error) {
+	var req VerifyLicenseRequest
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(DefaultMaxBodyBytes); err != nil {
+			return nil, fmt.Errorf("Invalid multipart body: %w", err)
+		}
+		file, _, err := r.FormFile("license")
+		if err != nil {
+			return nil, errors.New("License file is required")
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, errors.New("Invalid license file")
+		}
+		req.License = data
+		req.MachineID = r.FormValue("machine_id")
+		req.AppID = r.FormValue("app_id")
+		req.AppVersion = r.FormValue("app_version")
+		req.Hostname = r.FormValue("hostname")
+		req.IPs = r.Form["ip"]
+		if req.Usage, err = parseUsage(r.FormValue); err != nil {
+			return nil, err
+		}
+
+	case "application/octet-stream":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid request body: %w", err)
+		}
+		req.License = data
+		req.MachineID = r.URL.Query().Get("machine_id")
+		req.AppID = r.URL.Query().Get("app_id")
+		req.AppVersion = r.URL.Query().Get("app_version")
+		req.Hostname = r.URL.Query().Get("hostname")
+		req.IPs = r.URL.Query()["ip"]
+		if req.Usage, err = parseUsage(r.URL.Query().Get); err != nil {
+			return nil, err
+		}
+
+	default:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, fmt.Errorf("Invalid request body: %w", err)
+		}
+
+		// License也可以是字符串形式的文件内容
+		var raw string
+		if err := json.Unmarshal(req.License, &raw); err == nil {
+			req.License = []byte(raw)
+		}
+	}
+
+	if len(req.License) == 0 {
+		return nil, errors.New("License is required")
+	}
+	// 绑定主机名或网络的License可以只提供hostname或ips
+	if req.MachineID == "" && req.Hostname == "" && len(req.IPs) == 0 && !isUnbound(req.License) {
+		return nil, errors.New("Machine ID is required")
+	}
+
+	return &req, nil
+}
+
+// 不绑定的License验证时不需要机器ID、主机名或IP地址，只需要 usage 中的实例数
+func isUnbound(data []byte) bool {
+	lic, err := license.Decode(data)
+	return err == nil && lic.Binding.Type() == license.BindUnbound
+}
+
+// 解析表单或查询参数中的 cores、users、instances，均未提供时返回 nil
+func parseUsage(get func(string) string) (*license.Usage, error) {
+	var usage license.Usage
+	var found bool
+	for name, dst := range map[string]*int{"cores": &usage.Cores, "users": &usage.Users, "instances": &usage.Instances} {
+		v := get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid %s", name)
+		}
+		*dst = n
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	return &usage, nil
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/audit"
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/store"
+)
+
+// 创建使用临时存储目录的测试服务
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	st, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Store: st, DefaultDays: 30}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// 以JSON格式调用生成接口，返回状态码和解析后的响应
+func postGenerate(t *testing.T, ts *httptest.Server, req GenerateLicenseRequest) (int, Response) {
+	t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Error(err)
+		return 0, Response{}
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/license/generate", bytes.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return 0, Response{}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+
+	resp, err := ts.Client().Do(httpReq)
+	if err != nil {
+		t.Error(err)
+		return 0, Response{}
+	}
+	defer resp.Body.Close()
+
+	var r Response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		t.Errorf("decode response: %v", err)
+	}
+	return resp.StatusCode, r
+}
+
+// 并发生成的License各自编码，每个响应都是请求的机器ID对应的License
+func TestGenerateParallel(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	const n = 32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			machineID := fmt.Sprintf("machine-%02d", i)
+			status, resp := postGenerate(t, ts, GenerateLicenseRequest{MachineID: machineID, AppID: "app", Days: 10})
+			if status != http.StatusOK {
+				t.Errorf("%s: status %d, error %q", machineID, status, resp.Error)
+				return
+			}
+			lic, err := license.Decode([]byte(resp.Data))
+			if err != nil {
+				t.Errorf("%s: decode license: %v", machineID, err)
+				return
+			}
+			if lic.MachineID != machineID {
+				t.Errorf("requested %s, got license for %s", machineID, lic.MachineID)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// 同一机器的并发请求不能超出签发上限
+func TestMachineCapParallel(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.MachineCap = 1
+	s.MachineCapPeriod = time.Hour
+	// 审计日志的写入拉长检查和记录之间的时间，和生产环境一样
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), audit.DefaultFile), audit.DefaultKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Audit = auditLog
+
+	const n = 50
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	statuses := make(map[int]int)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, _ := postGenerate(t, ts, GenerateLicenseRequest{MachineID: "machine", AppID: "app", Days: 10})
+			mu.Lock()
+			statuses[status]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusTooManyRequests] != n-1 {
+		t.Errorf("statuses %v, want one %d and %d times %d", statuses, http.StatusOK, n-1, http.StatusTooManyRequests)
+	}
+}
+
+// 通配模式不能绕过按应用设置的有效期上限和应用白名单
+func TestGenerateAppPatternLimits(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.MaxDaysPerApp = map[string]int{"cf.suite.a": 30}
+
+	req := GenerateLicenseRequest{MachineID: "machine", AppID: "cf.suite.a", AppIDs: []string{"cf.suite.*"}, Days: 3650}
+	if status, resp := postGenerate(t, ts, req); status != http.StatusBadRequest {
+		t.Errorf("pattern beyond the app limit: status %d, error %q", status, resp.Error)
+	}
+	req.AppID = "other"
+	if status, resp := postGenerate(t, ts, req); status != http.StatusBadRequest {
+		t.Errorf("pattern beyond the limit of a matched app: status %d, error %q", status, resp.Error)
+	}
+	req.Days = 30
+	if status, resp := postGenerate(t, ts, req); status != http.StatusOK {
+		t.Errorf("pattern within the limit: status %d, error %q", status, resp.Error)
+	}
+
+	s.AllowedAppIDs = []string{"other", "cf.suite.a"}
+	if status, resp := postGenerate(t, ts, req); status != http.StatusForbidden {
+		t.Errorf("pattern not on the allow list: status %d, error %q", status, resp.Error)
+	}
+	s.AllowedAppIDs = append(s.AllowedAppIDs, "cf.suite.*")
+	if status, resp := postGenerate(t, ts, req); status != http.StatusOK {
+		t.Errorf("pattern on the allow list: status %d, error %q", status, resp.Error)
+	}
+}
+
+// 请求不能冒充签发人
+func TestGenerateIssuedBy(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.AuthEnabled = true
+	s.APIKeys = map[string]string{"secret": "backend"}
+
+	body := []byte(`{"machine_id":"machine","app_id":"app","customer_name":"ACME","issued_by":"someone else"}`)
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/license/generate", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-API-Key", "secret")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var r Response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	lic, err := license.Decode([]byte(r.Data))
+	if err != nil {
+		t.Fatalf("status %d, error %q: %v", resp.StatusCode, r.Error, err)
+	}
+	if lic.IssuedBy != "backend" {
+		t.Errorf("issued by %q, want the API key name", lic.IssuedBy)
+	}
+
+	// 续期的License记录续期的调用方，而不是原License的签发人
+	ctx := context.WithValue(context.Background(), clientNameKey, "renewer")
+	renewed, err := s.renewLicense(ctx, RenewLicenseRequest{License: json.RawMessage(r.Data), Days: 10}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed.IssuedBy != "renewer" || renewed.CustomerName != "ACME" {
+		t.Errorf("renewed license issued by %q for %q, want the renewing client for the original customer", renewed.IssuedBy, renewed.CustomerName)
+	}
+	if err := renewed.Verify(license.BindingContext{MachineID: "machine"}, "app"); err != nil {
+		t.Errorf("renewed license: %v", err)
+	}
+}
+
+// 审计日志写入失败时续期被撤销，原License可以再次续期
+func TestRenewAuditFailure(t *testing.T) {
+	s, _ := newTestServer(t)
+	auditFile := filepath.Join(t.TempDir(), audit.DefaultFile)
+	auditLog, err := audit.Open(auditFile, audit.DefaultKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	lic, err := s.issueLicense(ctx, audit.ActionGenerate, GenerateLicenseRequest{MachineID: "machine", AppID: "app", Days: 10}, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := lic.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 审计日志的路径变成目录后无法写入
+	s.Audit = auditLog
+	if err := os.Mkdir(auditFile, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.renewLicense(ctx, RenewLicenseRequest{License: data, Days: 10}, ""); err == nil {
+		t.Fatal("renewal succeeded without an audit log")
+	}
+	records, err := s.Store.ListRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].SupersededBy != "" {
+		t.Errorf("records after the failed renewal: %d, superseded by %q", len(records), records[0].SupersededBy)
+	}
+
+	s.Audit = nil
+	if _, err := s.renewLicense(ctx, RenewLicenseRequest{License: data, Days: 10}, ""); err != nil {
+		t.Errorf("renewal after the failed one: %v", err)
+	}
+}
+
+// 连续续期不能超出有效期上限，续期同样受机器签发数量的限制
+func TestRenewLimits(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.MaxDaysPerApp = map[string]int{"app": 30}
+	ctx := context.Background()
+	lic, err := s.issueLicense(ctx, audit.ActionGenerate, GenerateLicenseRequest{MachineID: "machine", AppID: "app", Days: 20}, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := lic.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reqErr *requestError
+	_, err = s.renewLicense(ctx, RenewLicenseRequest{License: data, Days: 20}, "")
+	if !errors.As(err, &reqErr) || reqErr.Status != http.StatusBadRequest {
+		t.Errorf("renewal beyond the app limit: %v, want status %d", err, http.StatusBadRequest)
+	}
+
+	s.MachineCap = 1
+	s.MachineCapPeriod = time.Hour
+	_, err = s.renewLicense(ctx, RenewLicenseRequest{License: data, Days: 5}, "")
+	if !errors.As(err, &reqErr) || reqErr.Status != http.StatusTooManyRequests {
+		t.Errorf("renewal beyond the machine cap: %v, want status %d", err, http.StatusTooManyRequests)
+	}
+	s.MachineCap = 0
+	if _, err := s.renewLicense(ctx, RenewLicenseRequest{License: data, Days: 5}, ""); err != nil {
+		t.Errorf("renewal within the limits: %v", err)
+	}
+}
+
+// 覆盖多个应用的License不能加密，其他应用无法用自己的密钥解密
+func TestGenerateMultiAppEncrypted(t *testing.T) {
+	s, ts := newTestServer(t)
+	license.SetEncryptionKey([]byte("0123456789abcdef0123456789abcdef"))
+	t.Cleanup(func() { license.SetEncryptionKey(nil) })
+
+	req := GenerateLicenseRequest{MachineID: "machine", AppID: "cf.suite", AppIDs: []string{"cf.suite.*"}, Encrypt: true}
+	if status, r := postGenerate(t, ts, req); status != http.StatusBadRequest || !strings.Contains(r.Error, "several applications") {
+		t.Errorf("encrypted multi-app license: status %d, error %q, want status %d", status, r.Error, http.StatusBadRequest)
+	}
+
+	s.EncryptLicenses = true
+	req.Encrypt = false
+	if status, _ := postGenerate(t, ts, req); status != http.StatusBadRequest {
+		t.Errorf("multi-app license with encryption configured: status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	req.AppIDs = nil
+	status, r := postGenerate(t, ts, req)
+	if status != http.StatusOK || !license.IsEncrypted([]byte(r.Data)) {
+		t.Errorf("single app license: status %d, error %q, want an encrypted license", status, r.Error)
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/chenwes/licensemodule/pkg/utils"
+)
+
+// 获取服务所在机器的ID，container=true 时使用容器环境的获取方式
+func (s *Server) HandleGetMachineID(w http.ResponseWriter, r *http.Request) {
+	var id string
+	var err error
+
+	if r.URL.Query().Get("container") == "true" {
+		id, err = utils.GetContainerizedMachineID()
+	} else {
+		id, err = utils.GetMachineID()
+	}
+
+	if err != nil {
+		sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, Response{Success: true, Data: id})
+}
@@ -0,0 +1,773 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// operation 一个接口的 OpenAPI 描述
+type operation struct {
+	ID          string
+	Summary     string
+	Description string
+	Params      []any
+	Body        any
+	Responses   map[string]any
+}
+
+// 获取 OpenAPI 文档接口
+func (s *Server) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, s.OpenAPI())
+}
+
+// OpenAPI 根据路由表生成 OpenAPI 3 文档，保证文档与实际注册的接口一致
+func (s *Server) OpenAPI() map[string]any {
+	routes := s.routes()
+
+	docs := make(map[string]*operation)
+	for _, rt := range routes {
+		if rt.Doc != nil {
+			docs[rt.Path] = rt.Doc
+		}
+	}
+
+	paths := make(map[string]any)
+	for _, rt := range routes {
+		doc := rt.Doc
+		if doc == nil {
+			doc = docs[rt.Successor]
+		}
+		if doc == nil {
+			doc = &operation{Summary: rt.Method + " " + rt.Path}
+		}
+
+		op := map[string]any{
+			"summary":   doc.Summary,
+			"responses": doc.Responses,
+		}
+		if doc.ID != "" {
+			id := doc.ID
+			if rt.Successor != "" {
+				id += "Deprecated" + operationSuffix(rt.Path)
+			}
+			op["operationId"] = id
+		}
+		if doc.Description != "" {
+			op["description"] = doc.Description
+		}
+		if len(doc.Params) > 0 {
+			op["parameters"] = doc.Params
+		}
+		if doc.Body != nil {
+			op["requestBody"] = doc.Body
+		}
+		if doc.Responses == nil {
+			op["responses"] = map[string]any{"200": map[string]any{"description": "OK"}}
+		}
+		if rt.Issuing {
+			op["security"] = []any{
+				map[string]any{"apiKey": []any{}},
+				map[string]any{"bearer": []any{}},
+				map[string]any{"mutualTLS": []any{}},
+			}
+		}
+		if rt.Successor != "" {
+			op["deprecated"] = true
+			op["description"] = "Deprecated, use " + rt.Successor + "."
+		}
+
+		item, _ := paths[rt.Path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[rt.Path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "CF License Server",
+			"version": s.Build.Version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"apiKey":    map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer":    map[string]any{"type": "http", "scheme": "bearer"},
+				"mutualTLS": map[string]any{"type": "mutualTLS"},
+			},
+		},
+	}
+}
+
+// 将旧路径转换为 operationId 后缀，例如 /api/license/generate -> ApiLicenseGenerate
+func operationSuffix(path string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '-' || r == '.' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// 引用 components 中的 schema
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// JSON 响应
+func jsonResponse(description, schema string) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": ref(schema)},
+		},
+	}
+}
+
+var errorResponse = jsonResponse("Error", "Response")
+
+var schemas = map[string]any{
+	"Response": map[string]any{
+		"type":     "object",
+		"required": []string{"success"},
+		"properties": map[string]any{
+			"success": map[string]any{"type": "boolean"},
+			"data":    map[string]any{"type": "string", "description": "Result data, for generate the license.dat content"},
+			"error":   map[string]any{"type": "string"},
+			"code": map[string]any{
+				"type":        "string",
+				"description": "Verification failure reason",
+				"enum":        []string{"expired", "machine_mismatch", "binding_mismatch", "app_mismatch", "bad_signature", "time_manipulated", "revoked", "limit_exceeded", "superseded", "version_mismatch", "invalid", "error"},
+			},
+		},
+	},
+	"GenerateLicenseRequest": map[string]any{
+		"type":     "object",
+		"required": []string{"app_id"},
+		"properties": map[string]any{
+			"machine_id":    map[string]any{"type": "string", "description": "Required for machine bound licenses"},
+			"app_id":        map[string]any{"type": "string"},
+			"days":          map[string]any{"type": "integer", "description": "Validity in days, the server default is used when 0"},
+			"features":      map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"seats":         map[string]any{"type": "integer", "description": "Issue a floating license with this many concurrent seats, served by the lease endpoints"},
+			"edition":       map[string]any{"type": "string", "description": "Catalog edition, expands to its features, validity and limits; explicit days and limits take precedence and features are added"},
+			"max_cores":     map[string]any{"type": "integer", "description": "Maximum CPU cores of the licensed machine, 0 for unlimited"},
+			"max_users":     map[string]any{"type": "integer", "description": "Maximum users of the application, 0 for unlimited"},
+			"max_instances": map[string]any{"type": "integer", "description": "Maximum running instances of the application, 0 for unlimited"},
+			"app_ids":       map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Further applications covered by the license, app IDs or glob patterns such as cf.suite.*; each must be allowed"},
+			"app_features":  appFeaturesSchema,
+			"min_version":   map[string]any{"type": "string", "description": "Lowest application version covered, e.g. 2 or 2.1.0"},
+			"max_version":   map[string]any{"type": "string", "description": "Highest application version covered; partial versions like 2.x cover every matching version"},
+			"customer_name": map[string]any{"type": "string"},
+			"customer_id":   map[string]any{"type": "string"},
+			"contract":      map[string]any{"type": "string", "description": "Contract or order number"},
+			"contact_email": map[string]any{"type": "string", "format": "email"},
+			"metadata":      metadataSchema,
+			"binding":       bindingSchema,
+			"hostnames":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Hostnames or *.domain patterns of a host binding"},
+			"networks":      map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "CIDRs of a network binding, e.g. 10.1.0.0/16"},
+			"encrypt":       map[string]any{"type": "boolean", "description": "Return the license.dat encrypted with the key of the application, not possible with app_ids"},
+		},
+	},
+	"RenewLicenseRequest": map[string]any{
+		"type":     "object",
+		"required": []string{"license"},
+		"properties": map[string]any{
+			"license": map[string]any{
+				"description": "License to renew, as an object or the license.dat content as a string, which may be encrypted",
+				"oneOf":       []any{ref("License"), map[string]any{"type": "string"}},
+			},
+			"days":     map[string]any{"type": "integer", "description": "Days added to the expiry, counted from today when the license has expired; 0 only adds features"},
+			"features": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Features added to those of the license"},
+			"encrypt":  map[string]any{"type": "boolean", "description": "Return the license.dat encrypted, always the case when the license to renew is encrypted"},
+		},
+	},
+	"VerifyLicenseRequest": map[string]any{
+		"type":     "object",
+		"required": []string{"license"},
+		"properties": map[string]any{
+			"license": map[string]any{
+				"description": "License object, or the license.dat content as a string, which may be encrypted",
+				"oneOf":       []any{ref("License"), map[string]any{"type": "string"}},
+			},
+			"machine_id":  map[string]any{"type": "string", "description": "Required unless hostname or ips is given or the license is unbound"},
+			"app_id":      map[string]any{"type": "string"},
+			"usage":       ref("Usage"),
+			"app_version": map[string]any{"type": "string", "description": "Version of the calling application, checked against the version range of the license"},
+			"hostname":    map[string]any{"type": "string", "description": "Hostname of the client, for host bound licenses"},
+			"ips":         map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "IP addresses of the client, for network bound licenses"},
+		},
+	},
+	"Usage": map[string]any{
+		"type":        "object",
+		"description": "Runtime facts reported by the client, checked against the limits of the license. Unbound licenses need instances.",
+		"properties": map[string]any{
+			"cores":     map[string]any{"type": "integer"},
+			"users":     map[string]any{"type": "integer"},
+			"instances": map[string]any{"type": "integer"},
+		},
+	},
+	"License": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"serial":          map[string]any{"type": "string"},
+			"machine_id":      map[string]any{"type": "string"},
+			"app_id":          map[string]any{"type": "string"},
+			"expiry_date":     map[string]any{"type": "string", "format": "date-time"},
+			"features":        map[string]any{"type": []string{"array", "null"}, "items": map[string]any{"type": "string"}},
+			"signature":       map[string]any{"type": "string"},
+			"key_id":          map[string]any{"type": "string", "description": "ID of the key that signed the license"},
+			"creation_date":   map[string]any{"type": "string", "format": "date-time"},
+			"time_zone":       map[string]any{"type": "string"},
+			"seats":           map[string]any{"type": "integer", "description": "Concurrent seats of a floating license"},
+			"trial":           map[string]any{"type": "boolean", "description": "Self-issued trial license"},
+			"edition":         map[string]any{"type": "string"},
+			"previous_serial": map[string]any{"type": "string", "description": "Serial of the license this one renews"},
+			"original_serial": map[string]any{"type": "string", "description": "Serial of the first license of the renewal chain"},
+			"app_ids":         map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Further applications covered by the license, app IDs or glob patterns"},
+			"app_features":    appFeaturesSchema,
+			"min_version":     map[string]any{"type": "string"},
+			"max_version":     map[string]any{"type": "string"},
+			"customer_name":   map[string]any{"type": "string"},
+			"customer_id":     map[string]any{"type": "string"},
+			"contract":        map[string]any{"type": "string", "description": "Contract or order number"},
+			"contact_email":   map[string]any{"type": "string"},
+			"issued_by":       map[string]any{"type": "string", "description": "Person or client that issued the license"},
+			"metadata":        metadataSchema,
+			"binding":         bindingSchema,
+			"hostnames":       map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"networks":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"max_cores":       map[string]any{"type": "integer"},
+			"max_users":       map[string]any{"type": "integer"},
+			"max_instances":   map[string]any{"type": "integer"},
+		},
+	},
+	"ActivateRequest": map[string]any{
+		"type":     "object",
+		"required": []string{"code", "machine_id"},
+		"properties": map[string]any{
+			"code":       map[string]any{"type": "string", "description": "Activation code, dashes and case are ignored"},
+			"machine_id": map[string]any{"type": "string"},
+		},
+	},
+	"CreateActivationCodesRequest": map[string]any{
+		"type":     "object",
+		"required": []string{"app_id"},
+		"properties": map[string]any{
+			"app_id":          map[string]any{"type": "string"},
+			"features":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"edition":         map[string]any{"type": "string", "description": "Catalog edition, expanded to its features and validity when the codes are created"},
+			"days":            map[string]any{"type": "integer", "description": "Validity of each license from activation, the server default is used when 0"},
+			"max_activations": map[string]any{"type": "integer", "description": "Machines that may be active at the same time, 1 when 0"},
+			"count":           map[string]any{"type": "integer", "description": "Number of codes to create, 1 when 0", "maximum": MaxActivationCodes},
+		},
+	},
+	"LicensesResponse": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"success":  map[string]any{"type": "boolean"},
+			"licenses": map[string]any{"type": "array", "items": ref("LicenseRecord")},
+		},
+	},
+	"LicenseRecord": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"license":       ref("License"),
+			"issued_by":     map[string]any{"type": "string", "description": "Authenticated client that issued the license"},
+			"revoked_at":    map[string]any{"type": "string", "format": "date-time"},
+			"revoked_by":    map[string]any{"type": "string"},
+			"revoke_reason": map[string]any{"type": "string"},
+			"superseded_by": map[string]any{"type": "string", "description": "Serial of the renewal of this license"},
+		},
+	},
+	"ActivationCodesResponse": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"success": map[string]any{"type": "boolean"},
+			"codes":   map[string]any{"type": "array", "items": ref("ActivationCode")},
+		},
+	},
+	"ActivationCode": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"code":            map[string]any{"type": "string", "description": "Only returned when the code is created, the server stores a hash of it"},
+			"id":              map[string]any{"type": "string", "description": "Identifier derived from the hash of the code, recorded in audit logs"},
+			"app_id":          map[string]any{"type": "string"},
+			"features":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"edition":         map[string]any{"type": "string"},
+			"days":            map[string]any{"type": "integer"},
+			"max_activations": map[string]any{"type": "integer"},
+			"created_at":      map[string]any{"type": "string", "format": "date-time"},
+			"created_by":      map[string]any{"type": "string"},
+			"activations":     map[string]any{"type": "array", "items": ref("Activation")},
+		},
+	},
+	"Activation": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"machine_id":     map[string]any{"type": "string"},
+			"serial":         map[string]any{"type": "string"},
+			"activated_at":   map[string]any{"type": "string", "format": "date-time"},
+			"deactivated_at": map[string]any{"type": "string", "format": "date-time"},
+		},
+	},
+	"LeaseRequest": map[string]any{
+		"type":     "object",
+		"required": []string{"client_id"},
+		"properties": map[string]any{
+			"app_id":    map[string]any{"type": "string", "description": "Application to lease a seat of, for acquire"},
+			"client_id": map[string]any{"type": "string", "description": "Machine ID of the client"},
+			"user":      map[string]any{"type": "string", "description": "Optional user name, for acquire"},
+			"lease_id":  map[string]any{"type": "string", "description": "Lease to renew, borrow or release"},
+			"duration":  map[string]any{"type": "string", "description": "How long to borrow the lease for, for example 72h"},
+		},
+	},
+	"LeaseResponse": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"success": map[string]any{"type": "boolean"},
+			"error":   map[string]any{"type": "string"},
+			"lease":   ref("Lease"),
+		},
+	},
+	"Lease": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id":         map[string]any{"type": "string"},
+			"serial":     map[string]any{"type": "string", "description": "Serial of the floating license"},
+			"app_id":     map[string]any{"type": "string"},
+			"features":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"client_id":  map[string]any{"type": "string"},
+			"user":       map[string]any{"type": "string"},
+			"issued_at":  map[string]any{"type": "string", "format": "date-time"},
+			"expires_at": map[string]any{"type": "string", "format": "date-time"},
+			"borrowed":   map[string]any{"type": "boolean", "description": "Checked out for offline use, no heartbeats needed until it expires"},
+			"signature":  map[string]any{"type": "string"},
+		},
+	},
+	"LeaseStatusResponse": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"success": map[string]any{"type": "boolean"},
+			"pools":   map[string]any{"type": "array", "items": ref("LeasePool")},
+		},
+	},
+	"LeasePool": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"app_id":      map[string]any{"type": "string"},
+			"serial":      map[string]any{"type": "string"},
+			"seats":       map[string]any{"type": "integer"},
+			"in_use":      map[string]any{"type": "integer"},
+			"expiry_date": map[string]any{"type": "string", "format": "date-time"},
+			"leases":      map[string]any{"type": "array", "items": ref("Lease")},
+		},
+	},
+	"HealthResponse": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"status": map[string]any{"type": "string"},
+		},
+	},
+	"ReadyResponse": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"status":     map[string]any{"type": "string", "enum": []string{statusOK, statusNotReady}},
+			"version":    map[string]any{"type": "string"},
+			"git_commit": map[string]any{"type": "string"},
+			"checks":     map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+		},
+	},
+}
+
+var healthDoc = &operation{
+	ID:      "health",
+	Summary: "Liveness check",
+	Responses: map[string]any{
+		"200": jsonResponse("The server is alive", "HealthResponse"),
+	},
+}
+
+var readyDoc = &operation{
+	ID:      "ready",
+	Summary: "Readiness check of the signing key and store",
+	Responses: map[string]any{
+		"200": jsonResponse("The server is ready", "ReadyResponse"),
+		"503": jsonResponse("The server is not ready", "ReadyResponse"),
+	},
+}
+
+var machineIDDoc = &operation{
+	ID:      "getMachineID",
+	Summary: "Get the machine ID of the server",
+	Params: []any{
+		map[string]any{
+			"name":        "container",
+			"in":          "query",
+			"description": "Use the container machine ID",
+			"schema":      map[string]any{"type": "boolean"},
+		},
+	},
+	Responses: map[string]any{
+		"200": jsonResponse("Machine ID in data", "Response"),
+		"500": errorResponse,
+	},
+}
+
+// 按应用ID或模式追加的功能
+var appFeaturesSchema = map[string]any{
+	"type":                 "object",
+	"description":          "Extra features by app ID or pattern, added to features for the matching applications",
+	"additionalProperties": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+}
+
+// License的绑定方式
+var bindingSchema = map[string]any{
+	"type":        "string",
+	"enum":        []string{"machine", "host", "network", "unbound"},
+	"description": "What the license is bound to, machine when empty. Only machine bound licenses have a machine_id, unbound ones need max_instances.",
+}
+
+// License中的自定义元数据
+var metadataSchema = map[string]any{
+	"type":                 "object",
+	"description":          "Free-form key/value pairs signed with the license",
+	"additionalProperties": map[string]any{"type": "string"},
+}
+
+var generateDoc = &operation{
+	ID:          "generateLicense",
+	Summary:     "Generate a license",
+	Description: "Returns license.dat as a download by default, or a Response with the license content in data when Accept is application/json.",
+	Body: map[string]any{
+		"required": true,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": ref("GenerateLicenseRequest")},
+		},
+	},
+	Responses: map[string]any{
+		"200": map[string]any{
+			"description": "Generated license",
+			"content": map[string]any{
+				"application/octet-stream": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+				"application/json":         map[string]any{"schema": ref("Response")},
+			},
+		},
+		"400": errorResponse,
+		"401": errorResponse,
+		"403": errorResponse,
+		"413": errorResponse,
+		"429": errorResponse,
+		"500": errorResponse,
+	},
+}
+
+var renewDoc = &operation{
+	ID:          "renewLicense",
+	Summary:     "Renew a license",
+	Description: "Issues the successor of a license issued by this server, with the expiry extended and features added. The new license records the previous serial, and the previous license is marked as superseded; a license can only be renewed once. Returns the license like generateLicense.",
+	Body: map[string]any{
+		"required": true,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": ref("RenewLicenseRequest")},
+		},
+	},
+	Responses: map[string]any{
+		"200": map[string]any{
+			"description": "Renewed license",
+			"content": map[string]any{
+				"application/octet-stream": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+				"application/json":         map[string]any{"schema": ref("Response")},
+			},
+		},
+		"400": errorResponse,
+		"401": errorResponse,
+		"403": errorResponse,
+		"404": errorResponse,
+		"409": errorResponse,
+		"413": errorResponse,
+		"429": errorResponse,
+		"500": errorResponse,
+		"503": errorResponse,
+	},
+}
+
+var verifyDoc = &operation{
+	ID:          "verifyLicense",
+	Summary:     "Verify a license",
+	Description: "The license is sent inline. A failed verification returns 200 with success false and the reason in code. When usage is given, the core, user and instance limits of the license are checked against it. Licenses with a version range require app_version. Only licenses issued by this server verify, failing with code invalid otherwise. Requests are rate limited per client IP.",
+	Params: []any{
+		map[string]any{"name": "machine_id", "in": "query", "description": "Machine ID for application/octet-stream bodies", "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "app_id", "in": "query", "description": "App ID for application/octet-stream bodies", "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "cores", "in": "query", "description": "CPU cores in use, for application/octet-stream bodies", "schema": map[string]any{"type": "integer", "minimum": 0}},
+		map[string]any{"name": "users", "in": "query", "description": "Users in use, for application/octet-stream bodies", "schema": map[string]any{"type": "integer", "minimum": 0}},
+		map[string]any{"name": "instances", "in": "query", "description": "Instances in use, for application/octet-stream bodies", "schema": map[string]any{"type": "integer", "minimum": 0}},
+		map[string]any{"name": "app_version", "in": "query", "description": "Version of the calling application, for application/octet-stream bodies", "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "hostname", "in": "query", "description": "Hostname of the client, for application/octet-stream bodies", "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "ip", "in": "query", "description": "IP address of the client, may be repeated, for application/octet-stream bodies", "schema": map[string]any{"type": "array", "items": map[string]any{"type": "string"}}},
+	},
+	Body: map[string]any{
+		"required": true,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": ref("VerifyLicenseRequest")},
+			"multipart/form-data": map[string]any{"schema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"license":     map[string]any{"type": "string", "format": "binary"},
+					"machine_id":  map[string]any{"type": "string"},
+					"app_id":      map[string]any{"type": "string"},
+					"cores":       map[string]any{"type": "integer"},
+					"users":       map[string]any{"type": "integer"},
+					"instances":   map[string]any{"type": "integer"},
+					"app_version": map[string]any{"type": "string"},
+					"hostname":    map[string]any{"type": "string"},
+					"ip":          map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				},
+			}},
+			"application/octet-stream": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+		},
+	},
+	Responses: map[string]any{
+		"200": jsonResponse("Verification result", "Response"),
+		"400": errorResponse,
+		"413": errorResponse,
+		"429": errorResponse,
+		"503": errorResponse,
+	},
+}
+
+var activateDoc = &operation{
+	ID:          "activate",
+	Summary:     "Exchange an activation code for a license bound to a machine",
+	Description: "Returns license.dat as a download by default, or a Response with the license content in data when Accept is application/json. Activating a machine that is already active issues a new license without using another activation. Licenses are valid for the configured activation days, clients activate again before they expire; the code's days count from the first activation and cap every license.",
+	Body: map[string]any{
+		"required": true,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": ref("ActivateRequest")},
+		},
+	},
+	Responses: map[string]any{
+		"200": map[string]any{
+			"description": "Activated license",
+			"content": map[string]any{
+				"application/octet-stream": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+				"application/json":         map[string]any{"schema": ref("Response")},
+			},
+		},
+		"400": errorResponse,
+		"403": errorResponse,
+		"404": errorResponse,
+		"409": jsonResponse("Activation limit reached", "Response"),
+		"429": errorResponse,
+		"500": errorResponse,
+	},
+}
+
+var offlineActivationDoc = &operation{
+	ID:          "activateOffline",
+	Summary:     "Issue a license for an offline activation request",
+	Description: "The body is the activation request file written by the machine or verify tool, or its compact LICREQ1: encoding. The machine, application and requested features are taken from the request. Returns license.dat as a download by default, or a Response when Accept is application/json.",
+	Params: []any{
+		map[string]any{"name": "days", "in": "query", "description": "Validity in days, the server default is used when omitted", "schema": map[string]any{"type": "integer"}},
+	},
+	Body: map[string]any{
+		"required": true,
+		"content": map[string]any{
+			"application/json":         map[string]any{"schema": map[string]any{"type": "object"}},
+			"text/plain":               map[string]any{"schema": map[string]any{"type": "string"}},
+			"application/octet-stream": map[string]any{"schema": map[string]any{"type": "string"}},
+		},
+	},
+	Responses: map[string]any{
+		"200": map[string]any{
+			"description": "Generated license",
+			"content": map[string]any{
+				"application/octet-stream": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+				"application/json":         map[string]any{"schema": ref("Response")},
+			},
+		},
+		"400": errorResponse,
+		"401": errorResponse,
+		"403": errorResponse,
+		"413": errorResponse,
+		"429": errorResponse,
+		"500": errorResponse,
+	},
+}
+
+var deactivateDoc = &operation{
+	ID:          "deactivate",
+	Summary:     "Release the activation of a machine",
+	Description: "Frees the activation so the code can be used on another machine, and revokes the license of the machine.",
+	Body: map[string]any{
+		"required": true,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": ref("ActivateRequest")},
+		},
+	},
+	Responses: map[string]any{
+		"200": jsonResponse("Deactivated", "Response"),
+		"400": errorResponse,
+		"404": errorResponse,
+		"429": errorResponse,
+		"500": errorResponse,
+	},
+}
+
+var listLicensesDoc = &operation{
+	ID:          "listLicenses",
+	Summary:     "Search issued licenses",
+	Description: "Lists the licenses issued by this server, oldest first, filtered by application, machine and customer data. Revoked licenses are left out unless include_revoked is true.",
+	Params: []any{
+		map[string]any{"name": "app_id", "in": "query", "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "machine_id", "in": "query", "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "customer", "in": "query", "description": "Part of the customer name, or the exact customer ID", "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "contract", "in": "query", "description": "Contract or order number", "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "email", "in": "query", "description": "Contact email", "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "metadata", "in": "query", "description": "Metadata value as key:value, may be repeated", "schema": map[string]any{"type": "array", "items": map[string]any{"type": "string"}}},
+		map[string]any{"name": "q", "in": "query", "description": "Part of any customer field or metadata value", "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "include_revoked", "in": "query", "schema": map[string]any{"type": "boolean"}},
+	},
+	Responses: map[string]any{
+		"200": jsonResponse("Matching licenses", "LicensesResponse"),
+		"400": errorResponse,
+		"401": errorResponse,
+		"429": errorResponse,
+		"500": errorResponse,
+		"503": errorResponse,
+	},
+}
+
+var listCodesDoc = &operation{
+	ID:      "listActivationCodes",
+	Summary: "List activation codes and their activations",
+	Params: []any{
+		map[string]any{"name": "app_id", "in": "query", "description": "Only return codes of this application", "schema": map[string]any{"type": "string"}},
+	},
+	Responses: map[string]any{
+		"200": jsonResponse("Activation codes", "ActivationCodesResponse"),
+		"401": errorResponse,
+		"429": errorResponse,
+		"500": errorResponse,
+	},
+}
+
+var createCodesDoc = &operation{
+	ID:      "createActivationCodes",
+	Summary: "Create activation codes",
+	Body: map[string]any{
+		"required": true,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": ref("CreateActivationCodesRequest")},
+		},
+	},
+	Responses: map[string]any{
+		"200": jsonResponse("Created activation codes", "ActivationCodesResponse"),
+		"400": errorResponse,
+		"401": errorResponse,
+		"403": errorResponse,
+		"429": errorResponse,
+		"500": errorResponse,
+	},
+}
+
+// 租约接口的请求体
+var leaseBody = map[string]any{
+	"required": true,
+	"content": map[string]any{
+		"application/json": map[string]any{"schema": ref("LeaseRequest")},
+	},
+}
+
+var acquireLeaseDoc = &operation{
+	ID:          "acquireLease",
+	Summary:     "Lease a seat of a floating license",
+	Description: "The lease is signed and expires after the lease TTL unless it is renewed. A client that already holds a lease gets it renewed instead of using another seat.",
+	Body:        leaseBody,
+	Responses: map[string]any{
+		"200": jsonResponse("Lease", "LeaseResponse"),
+		"400": errorResponse,
+		"403": errorResponse,
+		"404": errorResponse,
+		"409": jsonResponse("All seats are in use", "Response"),
+		"429": errorResponse,
+		"500": errorResponse,
+	},
+}
+
+var renewLeaseDoc = &operation{
+	ID:          "renewLease",
+	Summary:     "Renew a lease, sent periodically as a heartbeat",
+	Description: "Leases that are not renewed before they expire are reclaimed and their seat is freed.",
+	Body:        leaseBody,
+	Responses: map[string]any{
+		"200": jsonResponse("Renewed lease", "LeaseResponse"),
+		"400": errorResponse,
+		"403": errorResponse,
+		"404": errorResponse,
+		"429": errorResponse,
+		"500": errorResponse,
+	},
+}
+
+var borrowLeaseDoc = &operation{
+	ID:          "borrowLease",
+	Summary:     "Borrow a lease for offline use",
+	Description: "Extends the lease by duration, up to the configured maximum, so the client can work without heartbeats. The seat stays in use until the lease expires or is released.",
+	Body:        leaseBody,
+	Responses: map[string]any{
+		"200": jsonResponse("Borrowed lease", "LeaseResponse"),
+		"400": errorResponse,
+		"403": errorResponse,
+		"404": errorResponse,
+		"429": errorResponse,
+		"500": errorResponse,
+	},
+}
+
+var releaseLeaseDoc = &operation{
+	ID:      "releaseLease",
+	Summary: "Release a lease and free its seat",
+	Body:    leaseBody,
+	Responses: map[string]any{
+		"200": jsonResponse("Released", "LeaseResponse"),
+		"400": errorResponse,
+		"404": errorResponse,
+		"429": errorResponse,
+		"500": errorResponse,
+	},
+}
+
+var leaseStatusDoc = &operation{
+	ID:      "listLeases",
+	Summary: "Seats and active leases of each floating license",
+	Responses: map[string]any{
+		"200": jsonResponse("Floating licenses", "LeaseStatusResponse"),
+		"401": errorResponse,
+		"429": errorResponse,
+	},
+}
+
+var openAPIDoc = &operation{
+	ID:      "getOpenAPI",
+	Summary: "OpenAPI document of this server",
+	Responses: map[string]any{
+		"200": map[string]any{
+			"description": "OpenAPI 3 document",
+			"content":     map[string]any{"application/json": map[string]any{}},
+		},
+	},
+}
+
+var metricsDoc = &operation{
+	ID:      "getMetrics",
+	Summary: "Prometheus metrics",
+	Responses: map[string]any{
+		"200": map[string]any{
+			"description": "Metrics in the Prometheus text format",
+			"content":     map[string]any{"text/plain": map[string]any{}},
+		},
+	},
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/license"
+)
+
+// 签发数量检查按机器ID加锁的分片数
+const machineLockShards = 64
+
+// 按客户端IP限流，在认证之前执行，防止暴力尝试API Key
+func (s *Server) limitIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retryAfter := s.IPLimiter.Allow(clientIP(r)); !ok {
+			sendTooManyRequests(w, retryAfter, "Too many requests from this IP")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 按认证后的客户端（API Key或客户端证书）限流
+func (s *Server) limitClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := ClientName(r)
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, retryAfter := s.ClientLimiter.Allow(name); !ok {
+			sendTooManyRequests(w, retryAfter, "Too many requests for this API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 锁定机器ID，直到返回的函数被调用。签发数量的检查和签发记录的写入需要在同一把锁内完成，
+// 否则同一机器的并发请求都能通过检查
+func (s *Server) lockMachine(machineID string) func() {
+	if s.MachineCap <= 0 || machineID == "" {
+		return func() {}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(machineID))
+	mu := &s.machineLocks[h.Sum32()%machineLockShards]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// 检查同一机器ID在统计周期内的签发数量，超出时返回需要等待的时间。
+// 不绑定机器的License没有机器ID，不受此限制。调用方需要持有 lockMachine 的锁
+func (s *Server) checkMachineCap(machineID string) (bool, time.Duration, error) {
+	if s.MachineCap <= 0 || s.Store == nil || machineID == "" {
+		return true, 0, nil
+	}
+
+	now := time.Now().UTC()
+	issued, err := s.Store.IssuedSince(machineID, now.Add(-s.MachineCapPeriod))
+	if err != nil {
+		return false, 0, err
+	}
+	if len(issued) < s.MachineCap {
+		return true, 0, nil
+	}
+
+	// 等到足够多的旧License移出统计周期
+	oldest := issued[len(issued)-s.MachineCap]
+	return false, oldest.Add(s.MachineCapPeriod).Sub(now), nil
+}
+
+// 返回应用的最长有效期，0表示不限制。通配模式可能匹配任何应用，
+// 取 MaxDays 和它匹配的各应用上限中最严格的一个
+func (s *Server) maxDays(appID string) int {
+	if !license.IsAppPattern(appID) {
+		if days, ok := s.MaxDaysPerApp[appID]; ok {
+			return days
+		}
+		return s.MaxDays
+	}
+
+	days := s.MaxDays
+	for id, d := range s.MaxDaysPerApp {
+		if d > 0 && license.MatchApp(appID, id) && (days == 0 || d < days) {
+			days = d
+		}
+	}
+	return days
+}
+
+// 发送 429 响应并设置 Retry-After（秒）
+func sendTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	sendError(w, message, http.StatusTooManyRequests)
+}
+
+// 取出客户端IP，不信任 X-Forwarded-For 等可被伪造的请求头
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -2,80 +2,331 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/chenwes/licensemodule/internal/audit"
+	"github.com/chenwes/licensemodule/internal/catalog"
+	"github.com/chenwes/licensemodule/internal/floating"
 	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/metrics"
+	"github.com/chenwes/licensemodule/internal/ratelimit"
+	"github.com/chenwes/licensemodule/internal/store"
 )
 
+// DefaultMaxBodyBytes 默认的请求体大小上限
+const DefaultMaxBodyBytes = 1 << 20
+
+// DefaultFilenamePattern 默认的License下载文件名，{app} 和 {serial} 会被替换
+const DefaultFilenamePattern = "license-{app}-{serial}.dat"
+
+// Server 保存各个接口共享的依赖
+type Server struct {
+	Build   BuildInfo
+	Store   *store.Store
+	Metrics *metrics.Metrics // 为 nil 时不暴露 /metrics
+	Audit   *audit.Log       // 为 nil 时不记录审计日志
+	Logger  *slog.Logger     // 为 nil 时使用 slog.Default()
+
+	// Catalog 产品目录，为 nil 时不支持按版本签发
+	Catalog *catalog.Catalog
+
+	// Floating 管理浮动License的租约，为 nil 时不提供租约接口
+	Floating *floating.Manager
+
+	// FilenamePattern License下载文件名模板，为空时使用 DefaultFilenamePattern
+	FilenamePattern string
+
+	// DefaultDays 请求未指定有效期时使用的天数，MaxDays 为0表示不限制
+	DefaultDays int
+	MaxDays     int
+
+	// AllowedAppIDs 允许生成License的应用ID，为空表示不限制
+	AllowedAppIDs []string
+
+	// MaxBodyBytes 请求体大小上限，为0时使用 DefaultMaxBodyBytes
+	MaxBodyBytes int64
+
+	// MaxDaysPerApp 按应用设置的最长有效期，优先于 MaxDays
+	MaxDaysPerApp map[string]int
+
+	// ActivationDays 使用激活码签发的License的有效期，客户端需要在到期前重新激活换取新License，
+	// 反激活的机器因此最多再运行这么多天；为0时License覆盖激活码的完整有效期
+	ActivationDays int
+
+	// RejectSuperseded 为 true 时验证接口拒绝已被续期的License
+	RejectSuperseded bool
+
+	// EncryptLicenses 为 true 时所有签发的License文件都加密，需要先调用 license.SetEncryptionKey
+	EncryptLicenses bool
+
+	// IPLimiter 和 ClientLimiter 分别按客户端IP和认证后的客户端名称限流，为 nil 时不限流
+	IPLimiter     *ratelimit.Limiter
+	ClientLimiter *ratelimit.Limiter
+
+	// MachineCap 在 MachineCapPeriod 内同一机器ID最多可签发的License数量，为0时不限制
+	MachineCap       int
+	MachineCapPeriod time.Duration
+	machineLocks     [machineLockShards]sync.Mutex // 见 lockMachine
+
+	// AuthEnabled 为 true 时签发接口需要客户端证书或API Key，APIKeys 为 key 到名称的映射
+	AuthEnabled bool
+	APIKeys     map[string]string
+}
+
+// GenerateLicenseRequest 生成License的请求参数
 type GenerateLicenseRequest struct {
 	MachineID string   `json:"machine_id"`
 	AppID     string   `json:"app_id"`
 	Days      int      `json:"days"`
 	Features  []string `json:"features,omitempty"`
+	Seats     int      `json:"seats,omitempty"`   // 大于0时签发浮动License，MachineID 为License服务器的机器ID
+	Edition   string   `json:"edition,omitempty"` // 产品目录中的版本，展开为该版本的功能、有效期和数量限制
+
+	license.Limits // 核数、用户数、实例数上限，0表示不限制
+
+	// 同一License覆盖的其他应用，可以是应用ID或 cf.suite.* 形式的通配模式；
+	// AppFeatures 按应用ID或模式追加只对该应用生效的功能
+	AppIDs      []string            `json:"app_ids,omitempty"`
+	AppFeatures map[string][]string `json:"app_features,omitempty"`
+
+	// 适用的应用版本范围，可以是 2 或 2.x 这样的部分版本号，为空表示不限制
+	MinVersion string `json:"min_version,omitempty"`
+	MaxVersion string `json:"max_version,omitempty"`
+
+	// 客户名称和编号、合同号、联系邮箱及自定义元数据，随License签名；
+	// 请求中的 IssuedBy 被忽略，签发人总是调用方的 API Key 名称或客户端证书
+	license.Customer
+
+	// 绑定方式，默认绑定 MachineID；绑定主机名（host）、网段（network）或不绑定（unbound）时
+	// 不需要 MachineID，不绑定时必须指定 MaxInstances
+	license.Binding
+
+	// 为 true 时返回加密的License文件，只有持有该应用密钥的程序可以读取
+	Encrypt bool `json:"encrypt,omitempty"`
+
+	// 到期时间的上限，激活签发的License不能超出激活码的有效期，只在服务内部设置
+	notAfter time.Time
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+// VerifyLicenseRequest 验证License的请求参数，License内容可以是JSON对象，
+// 也可以是以字符串形式传递的 license.dat 原始内容
+type VerifyLicenseRequest struct {
+	License   json.RawMessage `json:"license"`
+	MachineID string          `json:"machine_id"`
+	AppID     string          `json:"app_id"`
+	Usage     *license.Usage  `json:"usage,omitempty"` // 客户端上报的核数、用户数和实例数，为空时不检查数量限制
+
+	// 客户端应用的版本，License限定了版本范围时必须提供
+	AppVersion string `json:"app_version,omitempty"`
+
+	// 客户端的主机名和IP地址，用于验证绑定主机名或网段的License
+	Hostname string   `json:"hostname,omitempty"`
+	IPs      []string `json:"ips,omitempty"`
 }
 
-// 生成License文件接口
-func HandleGenerateLicense(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// RenewLicenseRequest 续期License的请求参数，License内容与验证接口相同，可以是JSON对象或字符串。
+// 新License的有效期从原License的到期时间起延长 Days 天（原License已过期时从当前时间起），并追加 Features
+type RenewLicenseRequest struct {
+	License  json.RawMessage `json:"license"`
+	Days     int             `json:"days"` // 为0时只追加功能，不延长有效期
+	Features []string        `json:"features,omitempty"`
+	Encrypt  bool            `json:"encrypt,omitempty"` // 原License已加密时续期的License同样加密
+}
+
+// LicensesResponse 查询已签发License的响应
+type LicensesResponse struct {
+	Success  bool            `json:"success"`
+	Licenses []*store.Record `json:"licenses"`
+}
+
+// Response 统一的JSON响应格式，验证失败时 Code 为失败原因，
+// 取值与监控指标的 result 标签一致
+type Response struct {
+	Success bool   `json:"success"`
+	Data    string `json:"data,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Code    string `json:"code,omitempty"`
+}
+
+// route 描述一条路由，Issuing 表示签发接口（需要认证并受限流），Throttled 表示无需认证但按IP限流的接口，
+// Successor 不为空表示该路径已废弃，Doc 为该接口的 OpenAPI 描述，废弃路径沿用 Successor 的描述
+type route struct {
+	Method    string
+	Path      string
+	Handler   http.HandlerFunc
+	Issuing   bool
+	Throttled bool
+	Successor string
+	Doc       *operation
+}
+
+// 路由表，所有接口统一使用 /api/v1 前缀，旧路径作为废弃别名保留
+func (s *Server) routes() []route {
+	routes := []route{
+		{Method: http.MethodGet, Path: "/api/v1/health", Handler: s.HandleHealth, Doc: healthDoc},
+		{Method: http.MethodGet, Path: "/api/v1/ready", Handler: s.HandleReady, Doc: readyDoc},
+		{Method: http.MethodGet, Path: "/api/v1/machine-id", Handler: s.HandleGetMachineID, Doc: machineIDDoc},
+		{Method: http.MethodPost, Path: "/api/v1/license/generate", Handler: s.HandleGenerateLicense, Issuing: true, Doc: generateDoc},
+		{Method: http.MethodPost, Path: "/api/v1/license/verify", Handler: s.HandleVerifyLicense, Throttled: true, Doc: verifyDoc},
+		{Method: http.MethodPost, Path: "/api/v1/license/renew", Handler: s.HandleRenewLicense, Issuing: true, Doc: renewDoc},
+		{Method: http.MethodGet, Path: "/api/v1/licenses", Handler: s.HandleListLicenses, Issuing: true, Doc: listLicensesDoc},
+		{Method: http.MethodPost, Path: "/api/v1/activate", Handler: s.HandleActivate, Throttled: true, Doc: activateDoc},
+		{Method: http.MethodPost, Path: "/api/v1/activate/offline", Handler: s.HandleOfflineActivation, Issuing: true, Doc: offlineActivationDoc},
+		{Method: http.MethodPost, Path: "/api/v1/deactivate", Handler: s.HandleDeactivate, Throttled: true, Doc: deactivateDoc},
+		{Method: http.MethodGet, Path: "/api/v1/activation-codes", Handler: s.HandleListActivationCodes, Issuing: true, Doc: listCodesDoc},
+		{Method: http.MethodPost, Path: "/api/v1/activation-codes", Handler: s.HandleCreateActivationCodes, Issuing: true, Doc: createCodesDoc},
+		{Method: http.MethodGet, Path: "/openapi.json", Handler: s.HandleOpenAPI, Doc: openAPIDoc},
+
+		// 废弃的旧路径，分别保持原 cmd/api 和 cmd/http-server 的默认响应格式
+		{Method: http.MethodGet, Path: "/api/health", Handler: s.HandleHealth, Successor: "/api/v1/health"},
+		{Method: http.MethodGet, Path: "/api/ready", Handler: s.HandleReady, Successor: "/api/v1/ready"},
+		{Method: http.MethodPost, Path: "/api/license/generate", Handler: s.HandleGenerateLicense, Issuing: true, Successor: "/api/v1/license/generate"},
+		{Method: http.MethodGet, Path: "/machine-id", Handler: s.HandleGetMachineID, Successor: "/api/v1/machine-id"},
+		{Method: http.MethodPost, Path: "/generate", Handler: s.generateLicense(responseJSON), Issuing: true, Successor: "/api/v1/license/generate"},
+		{Method: http.MethodPost, Path: "/verify", Handler: s.HandleVerifyLicense, Throttled: true, Successor: "/api/v1/license/verify"},
 	}
 
-	// 解析请求参数
-	var req GenerateLicenseRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, "Invalid request body", http.StatusBadRequest)
-		return
+	if s.Floating != nil {
+		routes = append(routes,
+			route{Method: http.MethodPost, Path: "/api/v1/leases/acquire", Handler: s.HandleAcquireLease, Throttled: true, Doc: acquireLeaseDoc},
+			route{Method: http.MethodPost, Path: "/api/v1/leases/renew", Handler: s.HandleRenewLease, Throttled: true, Doc: renewLeaseDoc},
+			route{Method: http.MethodPost, Path: "/api/v1/leases/borrow", Handler: s.HandleBorrowLease, Throttled: true, Doc: borrowLeaseDoc},
+			route{Method: http.MethodPost, Path: "/api/v1/leases/release", Handler: s.HandleReleaseLease, Throttled: true, Doc: releaseLeaseDoc},
+			route{Method: http.MethodGet, Path: "/api/v1/leases", Handler: s.HandleLeaseStatus, Issuing: true, Doc: leaseStatusDoc},
+		)
+	}
+	if s.Metrics != nil {
+		routes = append(routes, route{Method: http.MethodGet, Path: "/metrics", Handler: s.Metrics.Handler().ServeHTTP, Doc: metricsDoc})
 	}
+	return routes
+}
 
-	// 验证请求参数
-	if req.MachineID == "" {
-		sendError(w, "Machine ID is required", http.StatusBadRequest)
-		return
+// Handler 返回注册了所有路由的 http.Handler
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	byPath := make(map[string]methodHandlers)
+	var paths []string
+	for _, rt := range s.routes() {
+		var h http.Handler = rt.Handler
+		if rt.Issuing {
+			h = s.limitClient(h)
+			h = s.requireAuth(h)
+			h = s.limitIP(h)
+		}
+		if rt.Throttled {
+			h = s.limitIP(h)
+		}
+		if rt.Successor != "" {
+			h = deprecated(rt.Successor, h)
+		}
+
+		if byPath[rt.Path] == nil {
+			byPath[rt.Path] = make(methodHandlers)
+			paths = append(paths, rt.Path)
+		}
+		byPath[rt.Path][rt.Method] = h
 	}
-	if req.AppID == "" {
-		sendError(w, "App ID is required", http.StatusBadRequest)
-		return
+	for _, path := range paths {
+		mux.Handle(path, s.Metrics.Instrument(path, byPath[path]))
 	}
-	if req.Days <= 0 {
-		sendError(w, "Days must be positive", http.StatusBadRequest)
-		return
+	return s.withRequestID(mux)
+}
+
+// Routes 返回 "METHOD PATH" 形式的路由列表，用于启动日志
+func (s *Server) Routes() []string {
+	var list []string
+	for _, rt := range s.routes() {
+		entry := rt.Method + " " + rt.Path
+		if rt.Successor != "" {
+			entry += " (deprecated, use " + rt.Successor + ")"
+		}
+		list = append(list, entry)
 	}
+	return list
+}
 
-	// 生成License文件
-	lic, err := license.NewLicense(req.MachineID, req.AppID, req.Days, req.Features)
-	if err != nil {
-		sendError(w, "Failed to generate license: "+err.Error(), http.StatusInternalServerError)
+// methodHandlers 按请求方法分发同一路径的请求，GET 接口同时允许 HEAD
+type methodHandlers map[string]http.Handler
+
+func (m methodHandlers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, ok := m[r.Method]
+	if !ok && r.Method == http.MethodHead {
+		h, ok = m[http.MethodGet]
+	}
+	if !ok {
+		var allow []string
+		for method := range m {
+			allow = append(allow, method)
+		}
+		sort.Strings(allow)
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	h.ServeHTTP(w, r)
+}
 
-	// Create temporary file
-	// 创建临时文件
-	tmpDir := os.TempDir()
-	tmpFile := filepath.Join(tmpDir, "license.dat")
-	if err := lic.Save(tmpFile); err != nil {
-		sendError(w, "Failed to save license: "+err.Error(), http.StatusInternalServerError)
-		return
+// 为废弃路径添加 Deprecation 和 Link 响应头
+func deprecated(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 限制请求体大小
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request) {
+	limit := s.MaxBodyBytes
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
 	}
-	defer os.Remove(tmpFile)
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+}
 
-	// 设置文件下载头
-	w.Header().Set("Content-Disposition", "attachment; filename=license.dat")
-	w.Header().Set("Content-Type", "application/octet-stream")
+// 解析JSON请求体，请求体超过大小上限时返回 413
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	s.limitBody(w, r)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			sendError(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return false
+		}
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
 
-	// 发送文件
-	http.ServeFile(w, r, tmpFile)
+// 发送JSON响应
+func sendJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
 
 // 发送错误响应
 func sendError(w http.ResponseWriter, message string, status int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+	sendJSON(w, status, Response{Success: false, Error: message})
+}
+
+// 发送 requestError 对应的错误响应，其他错误按 500 处理
+func sendRequestError(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if reqErr.Status == http.StatusTooManyRequests {
+		sendTooManyRequests(w, reqErr.RetryAfter, reqErr.Message)
+		return
+	}
+	sendError(w, reqErr.Message, reqErr.Status)
 }
@@ -0,0 +1,493 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/audit"
+	"github.com/chenwes/licensemodule/internal/catalog"
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/metrics"
+	"github.com/chenwes/licensemodule/internal/store"
+)
+
+// HTTP 和 gRPC 接口共用的License操作，调用方身份和请求ID从 context 中取出
+
+// requestError 请求无法完成的原因，Status 为对应的HTTP状态码，
+// gRPC 接口会将其转换为相应的状态码
+type requestError struct {
+	Status     int
+	Message    string
+	RetryAfter time.Duration // 仅用于 429
+}
+
+func (e *requestError) Error() string {
+	return e.Message
+}
+
+// 创建 requestError
+func newRequestError(status int, message string) *requestError {
+	return &requestError{Status: status, Message: message}
+}
+
+// 签发License，执行应用白名单、有效期上限、机器签发数量等策略，并以 action 写入审计日志和存储
+func (s *Server) issueLicense(ctx context.Context, action string, req GenerateLicenseRequest, details map[string]string) (*license.License, error) {
+	// 验证请求参数，只有绑定机器的License需要机器ID
+	bound := req.Binding.Type() != license.BindMachine
+	if err := req.Binding.Validate(); err != nil {
+		return nil, newRequestError(http.StatusBadRequest, "Invalid binding: "+err.Error())
+	}
+	if req.MachineID == "" && !bound {
+		return nil, newRequestError(http.StatusBadRequest, "Machine ID is required")
+	}
+	if req.MachineID != "" && bound {
+		return nil, newRequestError(http.StatusBadRequest, "Machine ID cannot be given for a "+req.Binding.Type()+" binding")
+	}
+	if req.AppID == "" {
+		return nil, newRequestError(http.StatusBadRequest, "App ID is required")
+	}
+	if req.Encrypt {
+		if err := license.CheckEncryptionKey(req.AppID); err != nil {
+			return nil, newRequestError(http.StatusBadRequest, "License encryption is not available: "+err.Error())
+		}
+	}
+	// 各应用只能用自己的密钥解密，覆盖多个应用的License不能加密
+	if (req.Encrypt || s.EncryptLicenses) && len(req.AppIDs) > 0 {
+		return nil, newRequestError(http.StatusBadRequest, license.ErrMultiAppEncryption.Error())
+	}
+	if req.Edition != "" {
+		ent, err := s.expandEdition(req.AppID, req.Edition, catalog.Entitlements{Features: req.Features, Days: req.Days, Limits: req.Limits})
+		if err != nil {
+			return nil, err
+		}
+		req.Features, req.Days, req.Limits = ent.Features, ent.Days, ent.Limits
+		details["edition"] = req.Edition
+		details["catalog_version"] = strconv.Itoa(s.Catalog.Version)
+	}
+	if req.Days == 0 {
+		req.Days = s.DefaultDays
+	}
+	if req.Days <= 0 {
+		return nil, newRequestError(http.StatusBadRequest, "Days must be positive")
+	}
+	if req.Seats < 0 {
+		return nil, newRequestError(http.StatusBadRequest, "Seats cannot be negative")
+	}
+	if req.Seats > 0 && bound {
+		return nil, newRequestError(http.StatusBadRequest, "Floating licenses are bound to the license server machine")
+	}
+	if err := req.Limits.Validate(); err != nil {
+		return nil, newRequestError(http.StatusBadRequest, "Invalid limits: "+err.Error())
+	}
+	// License覆盖的每个应用都需要在白名单中，有效期取其中最严格的上限
+	for _, appID := range append([]string{req.AppID}, req.AppIDs...) {
+		if !s.appAllowed(appID) {
+			return nil, newRequestError(http.StatusForbidden, "App ID is not allowed: "+appID)
+		}
+		if maxDays := s.maxDays(appID); maxDays > 0 && req.Days > maxDays {
+			return nil, newRequestError(http.StatusBadRequest, fmt.Sprintf("Days cannot exceed %d for app %s", maxDays, appID))
+		}
+	}
+
+	// 限制同一机器ID的签发数量，锁一直持有到签发记录写入之后
+	unlock := s.lockMachine(req.MachineID)
+	defer unlock()
+	ok, retryAfter, err := s.checkMachineCap(req.MachineID)
+	if err != nil {
+		return nil, newRequestError(http.StatusInternalServerError, "Failed to check machine license cap: "+err.Error())
+	}
+	if !ok {
+		return nil, &requestError{
+			Status:     http.StatusTooManyRequests,
+			Message:    "Too many licenses issued for this machine",
+			RetryAfter: retryAfter,
+		}
+	}
+
+	// 生成License，指定席位数时生成浮动License
+	var lic *license.License
+	switch {
+	case bound:
+		lic, err = license.NewBoundLicense(req.Binding, req.AppID, req.Days, req.Features, req.Limits)
+		if err != nil {
+			return nil, newRequestError(http.StatusBadRequest, err.Error())
+		}
+	case req.Seats > 0:
+		lic, err = license.NewFloatingLicense(req.MachineID, req.AppID, req.Days, req.Features, req.Seats)
+	default:
+		lic, err = license.NewLicense(req.MachineID, req.AppID, req.Days, req.Features)
+	}
+	if err == nil && (req.Edition != "" || !req.Limits.IsZero()) {
+		lic.Edition = req.Edition
+		lic.Limits = req.Limits
+		err = lic.Sign()
+	}
+	if err == nil && !req.notAfter.IsZero() && lic.ExpiryDate.After(req.notAfter) {
+		lic.ExpiryDate = req.notAfter.UTC()
+		err = lic.Sign()
+	}
+	if err != nil {
+		return nil, newRequestError(http.StatusInternalServerError, "Failed to generate license: "+err.Error())
+	}
+	if len(req.AppIDs) > 0 || len(req.AppFeatures) > 0 {
+		if err := lic.SetApps(req.AppIDs, req.AppFeatures); err != nil {
+			return nil, newRequestError(http.StatusBadRequest, err.Error())
+		}
+	}
+	// 签发人总是调用方的身份，不能由请求指定
+	req.IssuedBy = clientName(ctx)
+	if !req.Customer.IsZero() {
+		if err := lic.SetCustomer(req.Customer); err != nil {
+			return nil, newRequestError(http.StatusBadRequest, err.Error())
+		}
+	}
+	if req.MinVersion != "" || req.MaxVersion != "" {
+		if err := lic.SetVersionRange(req.MinVersion, req.MaxVersion); err != nil {
+			return nil, newRequestError(http.StatusBadRequest, "Invalid version range: "+err.Error())
+		}
+	}
+
+	// 写入审计日志，审计失败时不返回License
+	if err := s.audit(ctx, action, lic, details); err != nil {
+		s.contextLogger(ctx).Error("failed to write audit log", "serial", lic.Serial, "error", err)
+		return nil, newRequestError(http.StatusInternalServerError, "Failed to write audit log: "+err.Error())
+	}
+
+	// 记录已签发的License
+	if s.Store != nil {
+		if err := s.Store.PutRecord(&store.Record{License: lic, IssuedBy: clientName(ctx)}); err != nil {
+			s.contextLogger(ctx).Error("failed to store license", "serial", lic.Serial, "error", err)
+			return nil, newRequestError(http.StatusInternalServerError, "Failed to store license: "+err.Error())
+		}
+	}
+	s.Metrics.LicenseGenerated(lic.AppID)
+	s.contextLogger(ctx).Info("license generated",
+		"serial", lic.Serial, "app_id", lic.AppID, "machine_id", lic.MachineID,
+		"edition", lic.Edition, "expiry_date", lic.ExpiryDate, "client", clientName(ctx))
+
+	return lic, nil
+}
+
+// 按产品目录展开版本的功能、有效期和数量限制，请求中指定的有效期和限制优先，功能在版本的基础上追加
+func (s *Server) expandEdition(appID, edition string, requested catalog.Entitlements) (catalog.Entitlements, error) {
+	if s.Catalog == nil {
+		return requested, newRequestError(http.StatusBadRequest, "Editions are not configured on this server")
+	}
+	ent, err := s.Catalog.Expand(appID, edition, requested)
+	if err != nil {
+		return requested, newRequestError(http.StatusBadRequest, err.Error())
+	}
+	return ent, nil
+}
+
+// 返回记录防回拨时间戳的对象。机器绑定的License按机器记录；绑定主机名、网段或不绑定的License
+// 没有机器ID，按License序列号记录，否则这些客户端会共用同一个时间戳文件
+func timestampOwner(req *VerifyLicenseRequest) string {
+	lic, err := license.Decode(req.License)
+	if err != nil || lic.Binding.Type() == license.BindMachine {
+		return req.MachineID
+	}
+	if lic.Serial != "" {
+		return "serial:" + lic.Serial
+	}
+	return "signature:" + lic.Signature
+}
+
+// 验证License，返回验证通过的License，或者验证失败的原因。
+// 除License本身的校验外，还要求License由本服务签发且未被吊销。验证接口无需认证，
+// 签名和签发记录都通过之后才写入防回拨时间戳，避免任意请求在存储中创建文件
+func (s *Server) verifyLicense(ctx context.Context, req *VerifyLicenseRequest) (*license.License, error) {
+	if s.Store == nil {
+		return nil, newRequestError(http.StatusServiceUnavailable, errStoreNotConfigured.Error())
+	}
+
+	// 绑定信息取自客户端上报的机器ID、主机名和IP地址，不绑定的License还需要上报的实例数
+	binding := license.BindingContext{MachineID: req.MachineID, Hostname: req.Hostname}
+	if req.Usage != nil {
+		binding.Instances = req.Usage.Instances
+	}
+	for _, addr := range req.IPs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, newRequestError(http.StatusBadRequest, "Invalid IP address: "+addr)
+		}
+		binding.IPs = append(binding.IPs, ip)
+	}
+
+	lic, err := license.Decode(req.License)
+	if err != nil {
+		err = fmt.Errorf("failed to load license: %w", err)
+	}
+	if err == nil {
+		if err = lic.Verify(binding, req.AppID); err != nil {
+			err = fmt.Errorf("license verification failed: %w", err)
+		}
+	}
+	if err == nil {
+		err = s.checkRecord(lic.Serial)
+	}
+	if err == nil {
+		if err = license.CheckTimestamp(s.Store.TimestampFile(timestampOwner(req), req.AppID)); err != nil {
+			err = fmt.Errorf("timestamp check failed: %w", err)
+		}
+	}
+	if err == nil && req.Usage != nil {
+		err = lic.CheckLimits(*req.Usage)
+	}
+	if err == nil {
+		err = lic.CheckVersion(req.AppVersion)
+	}
+
+	s.Metrics.Verification(err)
+	s.contextLogger(ctx).Info("license verified",
+		"app_id", req.AppID, "machine_id", req.MachineID, "result", metrics.VerifyResult(err))
+	if err != nil {
+		return nil, err
+	}
+	return lic, nil
+}
+
+// 检查License是否由本服务签发、未被吊销，以及按配置是否已被续期
+func (s *Server) checkRecord(serial string) error {
+	rec, err := s.Store.GetRecord(serial)
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("%w: not issued by this server", license.ErrInvalidLicense)
+	}
+	if err != nil {
+		return err
+	}
+	if rec.Revoked() {
+		return store.ErrRevoked
+	}
+	if s.RejectSuperseded && rec.SupersededBy != "" {
+		return fmt.Errorf("%w: renewed as %s", license.ErrSupersededLicense, rec.SupersededBy)
+	}
+	return nil
+}
+
+// 续期本服务签发的License。新License沿用原License的机器、应用、版本和数量限制，
+// 并记录原License的序列号；每个License只能续期一次，避免续期链分叉
+func (s *Server) renewLicense(ctx context.Context, req RenewLicenseRequest, remoteAddr string) (*license.License, error) {
+	if s.Store == nil {
+		return nil, newRequestError(http.StatusServiceUnavailable, errStoreNotConfigured.Error())
+	}
+	if len(req.License) == 0 {
+		return nil, newRequestError(http.StatusBadRequest, "License is required")
+	}
+	if req.Days < 0 {
+		return nil, newRequestError(http.StatusBadRequest, "Days cannot be negative")
+	}
+
+	prev, err := license.Decode(req.License)
+	if err != nil {
+		return nil, newRequestError(http.StatusBadRequest, err.Error())
+	}
+	if req.Encrypt {
+		if err := license.CheckEncryptionKey(prev.AppID); err != nil {
+			return nil, newRequestError(http.StatusBadRequest, "License encryption is not available: "+err.Error())
+		}
+	}
+	if (req.Encrypt || s.EncryptLicenses) && len(prev.AppIDs) > 0 {
+		return nil, newRequestError(http.StatusBadRequest, license.ErrMultiAppEncryption.Error())
+	}
+	rec, err := s.Store.GetRecord(prev.Serial)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newRequestError(http.StatusNotFound, "License was not issued by this server")
+	}
+	if err != nil {
+		return nil, newRequestError(http.StatusBadRequest, err.Error())
+	}
+	if rec.Revoked() {
+		return nil, newRequestError(http.StatusConflict, "Revoked licenses cannot be renewed")
+	}
+	if rec.SupersededBy != "" {
+		return nil, newRequestError(http.StatusConflict, "License has already been renewed as "+rec.SupersededBy)
+	}
+	for _, appID := range append([]string{prev.AppID}, prev.AppIDs...) {
+		if !s.appAllowed(appID) {
+			return nil, newRequestError(http.StatusForbidden, "App ID is not allowed: "+appID)
+		}
+	}
+
+	// 续期和签发一样受机器签发数量的限制，锁一直持有到新License的记录写入之后
+	unlock := s.lockMachine(prev.MachineID)
+	defer unlock()
+	ok, retryAfter, err := s.checkMachineCap(prev.MachineID)
+	if err != nil {
+		return nil, newRequestError(http.StatusInternalServerError, "Failed to check machine license cap: "+err.Error())
+	}
+	if !ok {
+		return nil, &requestError{
+			Status:     http.StatusTooManyRequests,
+			Message:    "Too many licenses issued for this machine",
+			RetryAfter: retryAfter,
+		}
+	}
+
+	lic, err := license.Renew(prev, req.Days, req.Features, clientName(ctx))
+	if errors.Is(err, license.ErrInvalidSignature) {
+		return nil, newRequestError(http.StatusBadRequest, "Invalid license signature")
+	}
+	if err != nil {
+		return nil, newRequestError(http.StatusBadRequest, err.Error())
+	}
+	// 续期从原License的到期日开始延长，有效期上限按续期后的到期日检查，否则连续续期可以超出上限
+	for _, appID := range append([]string{prev.AppID}, prev.AppIDs...) {
+		if maxDays := s.maxDays(appID); maxDays > 0 && lic.ExpiryDate.After(lic.CreationDate.AddDate(0, 0, maxDays)) {
+			return nil, newRequestError(http.StatusBadRequest, fmt.Sprintf("Renewed license cannot expire more than %d days from now for app %s", maxDays, appID))
+		}
+	}
+
+	details := map[string]string{
+		"previous_serial": prev.Serial,
+		"days":            strconv.Itoa(req.Days),
+		"remote_addr":     remoteAddr,
+	}
+
+	// 先标记原License已续期，并发续期同一License时只有一个成功；再写入新License的记录，
+	// 最后写入审计日志。任何一步失败都撤销之前的步骤，原License可以再次续期
+	if _, err := s.Store.Supersede(prev.Serial, lic.Serial); err != nil {
+		if errors.Is(err, license.ErrSupersededLicense) {
+			return nil, newRequestError(http.StatusConflict, "License has already been renewed")
+		}
+		return nil, newRequestError(http.StatusInternalServerError, "Failed to store license: "+err.Error())
+	}
+	if err := s.Store.PutRecord(&store.Record{License: lic, IssuedBy: clientName(ctx)}); err != nil {
+		s.contextLogger(ctx).Error("failed to store license", "serial", lic.Serial, "error", err)
+		s.undoRenewal(ctx, prev.Serial, lic.Serial, false)
+		return nil, newRequestError(http.StatusInternalServerError, "Failed to store license: "+err.Error())
+	}
+	if err := s.audit(ctx, audit.ActionRenew, lic, details); err != nil {
+		s.contextLogger(ctx).Error("failed to write audit log", "serial", lic.Serial, "error", err)
+		s.undoRenewal(ctx, prev.Serial, lic.Serial, true)
+		return nil, newRequestError(http.StatusInternalServerError, "Failed to write audit log: "+err.Error())
+	}
+	s.Metrics.LicenseGenerated(lic.AppID)
+	s.contextLogger(ctx).Info("license renewed",
+		"serial", lic.Serial, "previous_serial", prev.Serial, "app_id", lic.AppID, "machine_id", lic.MachineID,
+		"expiry_date", lic.ExpiryDate, "client", clientName(ctx))
+
+	return lic, nil
+}
+
+// 撤销未完成的续期：删除已写入的新License记录，并清除原License的续期标记
+func (s *Server) undoRenewal(ctx context.Context, prevSerial, serial string, stored bool) {
+	if stored {
+		if err := s.Store.DeleteRecord(serial); err != nil {
+			s.contextLogger(ctx).Error("failed to remove renewed license", "serial", serial, "error", err)
+		}
+	}
+	if err := s.Store.Unsupersede(prevSerial, serial); err != nil {
+		s.contextLogger(ctx).Error("failed to undo renewal", "serial", prevSerial, "error", err)
+	}
+}
+
+// 吊销已签发的License
+func (s *Server) revokeLicense(ctx context.Context, serial, reason, remoteAddr string) (*store.Record, error) {
+	if s.Store == nil {
+		return nil, newRequestError(http.StatusServiceUnavailable, errStoreNotConfigured.Error())
+	}
+	if serial == "" {
+		return nil, newRequestError(http.StatusBadRequest, "Serial is required")
+	}
+
+	rec, err := s.Store.GetRecord(serial)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newRequestError(http.StatusNotFound, "License not found")
+	}
+	if err != nil {
+		return nil, newRequestError(http.StatusBadRequest, err.Error())
+	}
+	if rec.Revoked() {
+		return rec, nil
+	}
+
+	details := map[string]string{"remote_addr": remoteAddr}
+	if reason != "" {
+		details["reason"] = reason
+	}
+	if err := s.audit(ctx, audit.ActionRevoke, rec.License, details); err != nil {
+		s.contextLogger(ctx).Error("failed to write audit log", "serial", serial, "error", err)
+		return nil, newRequestError(http.StatusInternalServerError, "Failed to write audit log: "+err.Error())
+	}
+
+	rec, err = s.Store.Revoke(serial, actorName(ctx), reason)
+	if err != nil {
+		return nil, newRequestError(http.StatusInternalServerError, "Failed to revoke license: "+err.Error())
+	}
+	s.contextLogger(ctx).Info("license revoked",
+		"serial", serial, "reason", reason, "client", clientName(ctx))
+	return rec, nil
+}
+
+// listFilter 列出已签发License时的过滤条件，空字段表示不过滤
+type listFilter struct {
+	AppID          string
+	MachineID      string
+	IncludeRevoked bool
+
+	store.Query // 按客户、合同号、邮箱和元数据查找
+}
+
+// 列出已签发的License，按签发时间从早到晚排序
+func (s *Server) listLicenses(filter listFilter) ([]*store.Record, error) {
+	if s.Store == nil {
+		return nil, newRequestError(http.StatusServiceUnavailable, errStoreNotConfigured.Error())
+	}
+
+	records, err := s.Store.Search(filter.Query)
+	if err != nil {
+		return nil, newRequestError(http.StatusInternalServerError, "Failed to list licenses: "+err.Error())
+	}
+
+	var list []*store.Record
+	for _, rec := range records {
+		if filter.AppID != "" && rec.License.AppID != filter.AppID {
+			continue
+		}
+		if filter.MachineID != "" && rec.License.MachineID != filter.MachineID {
+			continue
+		}
+		if rec.Revoked() && !filter.IncludeRevoked {
+			continue
+		}
+		list = append(list, rec)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].License.CreationDate.Before(list[j].License.CreationDate)
+	})
+	return list, nil
+}
+
+// 记录针对某个License的审计事件
+func (s *Server) audit(ctx context.Context, action string, lic *license.License, details map[string]string) error {
+	if s.Audit == nil {
+		return nil
+	}
+
+	expiry := lic.ExpiryDate
+	return s.Audit.Append(audit.Event{
+		Action:     action,
+		Actor:      actorName(ctx),
+		Serial:     lic.Serial,
+		MachineID:  lic.MachineID,
+		AppID:      lic.AppID,
+		Features:   lic.Features,
+		ExpiryDate: &expiry,
+		Details:    details,
+	})
+}
+
+// 审计日志和吊销记录中的操作人，未认证时为 anonymous
+func actorName(ctx context.Context) string {
+	if name := clientName(ctx); name != "" {
+		return name
+	}
+	return "anonymous"
+}
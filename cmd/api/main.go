@@ -1,27 +1,348 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/chenwes/licensemodule/api"
+	"github.com/chenwes/licensemodule/internal/audit"
+	"github.com/chenwes/licensemodule/internal/catalog"
+	"github.com/chenwes/licensemodule/internal/certs"
+	"github.com/chenwes/licensemodule/internal/config"
+	"github.com/chenwes/licensemodule/internal/floating"
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/logging"
+	"github.com/chenwes/licensemodule/internal/metrics"
+	"github.com/chenwes/licensemodule/internal/ratelimit"
+	"github.com/chenwes/licensemodule/internal/store"
+	"github.com/chenwes/licensemodule/pkg/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// 版本信息，通过 ldflags 在编译时注入
+var (
+	version   = "unknown"
+	gitCommit = "unknown"
 )
 
 func main() {
 	// Define command line parameters
-	port := flag.String("port", "8080", "Port to listen on")
+	configFile := flag.String("config", "", "Config file path (YAML)")
+	port := flag.String("port", "", "Port to listen on, overrides the listen address in the config")
+	dataDir := flag.String("data", "", "Directory for server-side state, overrides the store path in the config")
 	flag.Parse()
 
+	// Load configuration: defaults < config file < environment < flags
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		logging.Fatal("failed to load config", "error", err)
+	}
+	if *port != "" {
+		cfg.Listen = ":" + *port
+	}
+	if *dataDir != "" {
+		cfg.Store.Path = *dataDir
+	}
+	if err := cfg.Validate(); err != nil {
+		logging.Fatal("invalid config", "error", err)
+	}
+
 	// Configure logging
-	log.SetPrefix("[LicenseAPI] ")
+	logger, err := logging.Setup(cfg.Log.Format, cfg.Log.Level, "license-api")
+	if err != nil {
+		logging.Fatal("failed to configure logging", "error", err)
+	}
+	license.SetLogger(logger)
+
+	logger.Info("CF License API Service Start", "version", version, "git_commit", gitCommit)
+	logger.Info("effective configuration", "config", cfg.Redacted())
+
+	// Load signing key
+	key, err := cfg.SigningKey()
+	if err != nil {
+		logging.Fatal("failed to load signing key", "error", err)
+	}
+	if key != nil {
+		license.SetSecretKey(key)
+	} else {
+		logger.Warn("using the builtin signing key, configure a key provider in production")
+	}
+	previousKeys, err := cfg.PreviousKeys()
+	if err != nil {
+		logging.Fatal("failed to load previous signing keys", "error", err)
+	}
+	for _, k := range previousKeys {
+		license.AddVerificationKey(k)
+		logger.Info("previous signing key loaded for verification", "fingerprint", license.KeyID(k))
+	}
+
+	// Load the master key of encrypted licenses
+	encryptionKey, err := cfg.EncryptionKey()
+	if err != nil {
+		logging.Fatal("failed to load encryption key", "error", err)
+	}
+	if encryptionKey != nil {
+		license.SetEncryptionKey(encryptionKey)
+	}
 
-	// Register handlers
-	http.HandleFunc("/api/license/generate", api.HandleGenerateLicense)
+	// Open store
+	st, err := store.Open(cfg.Store.Path)
+	if err != nil {
+		logging.Fatal("failed to open store", "error", err)
+	}
+
+	// Open audit log
+	auditKey, err := cfg.AuditKey()
+	if err != nil {
+		logging.Fatal("failed to load audit key", "error", err)
+	}
+	if auditKey == nil {
+		auditKey = audit.DefaultKey
+		logger.Warn("using the builtin audit key, configure audit.key_file in production")
+	}
+	auditLog, err := audit.Open(cfg.AuditPath(), auditKey)
+	if err != nil {
+		logging.Fatal("failed to open audit log", "error", err)
+	}
+	// Logging the head lets audit-verify -head detect a truncated or rewritten log later
+	head, err := auditLog.Head()
+	if err != nil {
+		logging.Fatal("failed to read audit log", "error", err)
+	}
+	logger.Info("audit log opened", "path", auditLog.Path(), "head", head.String())
+
+	var m *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		m = metrics.New(st, cfg.Metrics.ExpiringWithinDays)
+	}
+
+	// Load the product catalog for issuing by edition
+	var cat *catalog.Catalog
+	if cfg.License.Catalog != "" {
+		cat, err = catalog.Load(cfg.License.Catalog)
+		if err != nil {
+			logging.Fatal("failed to load catalog", "error", err)
+		}
+		logger.Info("catalog loaded", "path", cfg.License.Catalog, "version", cat.Version, "apps", len(cat.Apps))
+	}
+
+	// Serve the seats of floating licenses issued to this server
+	var fm *floating.Manager
+	if len(cfg.Floating.Licenses) > 0 {
+		fm, err = loadFloatingLicenses(logger, cfg, st)
+		if err != nil {
+			logging.Fatal("failed to load floating licenses", "error", err)
+		}
+	}
+
+	srv := &api.Server{
+		Build:            api.BuildInfo{Version: version, GitCommit: gitCommit},
+		Store:            st,
+		Metrics:          m,
+		Floating:         fm,
+		Catalog:          cat,
+		Audit:            auditLog,
+		Logger:           logger,
+		FilenamePattern:  cfg.License.Filename,
+		DefaultDays:      cfg.License.DefaultDays,
+		MaxDays:          cfg.License.MaxDays,
+		MaxDaysPerApp:    cfg.License.MaxDaysPerApp,
+		ActivationDays:   cfg.License.ActivationDays,
+		MaxBodyBytes:     cfg.Server.MaxBodyBytes,
+		AllowedAppIDs:    cfg.License.AllowedAppIDs,
+		RejectSuperseded: cfg.License.RejectSuperseded,
+		EncryptLicenses:  cfg.License.Encrypt,
+		IPLimiter:        ratelimit.New(cfg.RateLimit.PerIP.PerMinute, cfg.RateLimit.PerIP.Burst),
+		ClientLimiter:    ratelimit.New(cfg.RateLimit.PerClient.PerMinute, cfg.RateLimit.PerClient.Burst),
+		MachineCap:       cfg.RateLimit.MachineCap.MaxLicenses,
+		MachineCapPeriod: cfg.RateLimit.MachineCap.Period,
+		AuthEnabled:      cfg.Auth.Enabled,
+		APIKeys:          make(map[string]string),
+	}
+	for _, k := range cfg.Auth.APIKeys {
+		srv.APIKeys[k.Key] = k.Name
+	}
+
+	logger.Info("endpoints registered", "routes", srv.Routes())
+
+	httpServer := &http.Server{
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    1 << 20,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
 
 	// Start server
-	log.Printf("Starting server on port %s...", *port)
-	if err := http.ListenAndServe(":"+*port, nil); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		logging.Fatal("failed to listen", "listen", cfg.Listen, "error", err)
+	}
+	var reloader *certs.Reloader
+	if cfg.TLS.CertFile != "" {
+		reloader, err = certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile, cfg.TLS.ClientAuth)
+		if err != nil {
+			logging.Fatal("failed to load TLS certificates", "error", err)
+		}
+
+		ln = tls.NewListener(ln, reloader.TLSConfig())
+		logger.Info("starting HTTPS server", "listen", cfg.Listen, "client_auth", cfg.TLS.ClientAuth)
+	} else {
+		logger.Info("starting HTTP server", "listen", cfg.Listen)
+	}
+
+	go reloadOnHangup(logger, cfg, reloader, auditLog)
+
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- httpServer.Serve(ln)
+	}()
+
+	// Start gRPC server, sharing the TLS settings of the HTTP server
+	var grpcServer *grpc.Server
+	if cfg.GRPC.Listen != "" {
+		grpcLn, err := net.Listen("tcp", cfg.GRPC.Listen)
+		if err != nil {
+			logging.Fatal("failed to listen", "listen", cfg.GRPC.Listen, "error", err)
+		}
+
+		var opts []grpc.ServerOption
+		if reloader != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.TLSConfig())))
+		}
+		grpcServer = srv.GRPCServer(opts...)
+		logger.Info("starting gRPC server", "listen", cfg.GRPC.Listen, "tls", reloader != nil)
+
+		go func() {
+			serveErr <- grpcServer.Serve(grpcLn)
+		}()
+	}
+
+	// Wait for SIGINT/SIGTERM, then drain in-flight requests
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serveErr:
+		logging.Fatal("server failed", "error", err)
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down, draining in-flight requests", "timeout", cfg.Server.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if grpcServer != nil {
+		go func() {
+			<-shutdownCtx.Done()
+			grpcServer.Stop()
+		}()
+		grpcServer.GracefulStop()
+	}
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error("graceful shutdown failed", "error", err)
+		return
+	}
+	logger.Info("server stopped")
+}
+
+// Verify the configured floating licenses against this machine and load
+// them into a lease manager
+func loadFloatingLicenses(logger *slog.Logger, cfg *config.Config, st *store.Store) (*floating.Manager, error) {
+	machineID, err := utils.GetMachineID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get machine ID: %w", err)
+	}
+
+	fm, err := floating.New(st, cfg.Floating.LeaseTTL, cfg.Floating.MaxBorrow)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range cfg.Floating.Licenses {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read license file: %w", err)
+		}
+		lic, err := license.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if !lic.Floating() {
+			return nil, fmt.Errorf("%s: not a floating license", path)
+		}
+		if err := license.VerifyDataAndUpdate(data, st.TimestampFile(machineID, lic.AppID), machineID, lic.AppID); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := fm.AddLicense(lic); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		logger.Info("floating license loaded", "path", path, "serial", lic.Serial, "app_id", lic.AppID,
+			"seats", lic.Seats, "expiry_date", lic.ExpiryDate)
+	}
+	return fm, nil
+}
+
+// Reload TLS certificates and the signing key when SIGHUP is received
+func reloadOnHangup(logger *slog.Logger, cfg *config.Config, reloader *certs.Reloader, auditLog *audit.Log) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if reloader != nil {
+			if err := reloader.Reload(); err != nil {
+				logger.Error("failed to reload TLS certificates, keeping the previous ones", "error", err)
+			} else {
+				logger.Info("TLS certificates reloaded")
+			}
+		}
+
+		rotateSigningKey(logger, cfg, auditLog)
+	}
+}
+
+// Load the signing key again and record a key rotation if it changed. The
+// previous key keeps verifying the licenses it signed until the server
+// restarts, list it in key.previous_files to keep them valid after that.
+func rotateSigningKey(logger *slog.Logger, cfg *config.Config, auditLog *audit.Log) {
+	key, err := cfg.SigningKey()
+	if err != nil {
+		logger.Error("failed to reload signing key, keeping the previous one", "error", err)
+		return
+	}
+	if key == nil {
+		return
+	}
+
+	oldFingerprint := license.KeyFingerprint()
+	newFingerprint := license.KeyID(key)
+	if newFingerprint == oldFingerprint {
+		return
+	}
+
+	// Record the rotation before using the new key, so no license is signed
+	// with a key the audit log does not know
+	err = auditLog.Append(audit.Event{
+		Action: audit.ActionKeyRotation,
+		Actor:  "system:sighup",
+		Details: map[string]string{
+			"provider":        cfg.Key.Provider,
+			"old_fingerprint": oldFingerprint,
+			"new_fingerprint": newFingerprint,
+		},
+	})
+	if err != nil {
+		logger.Error("failed to write audit log for key rotation, keeping the previous key", "error", err)
+		return
 	}
+	license.RotateSecretKey(key)
+	logger.Info("signing key rotated", "old_fingerprint", oldFingerprint, "new_fingerprint", newFingerprint)
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/chenwes/licensemodule/internal/audit"
+	"github.com/chenwes/licensemodule/internal/logging"
+)
+
+// 版本信息，通过 ldflags 在编译时注入
+var (
+	version   = "unknown"
+	gitCommit = "unknown"
+)
+
+// This program is used to verify the hash chain of an audit log
+
+func main() {
+	// Define command line parameters
+	file := flag.String("file", audit.DefaultFile, "Audit log file path")
+	keyFile := flag.String("key", "", "File holding the key of the hash chain, the builtin key when empty")
+	expectHead := flag.String("head", "", "Head recorded earlier as seq:hash, e.g. from the server log; fails if the log no longer contains it")
+	logFormat := flag.String("log-format", logging.FormatText, "Log format: text or json")
+	flag.Parse()
+
+	// Configure logging
+	logger, err := logging.Setup(*logFormat, "info", "audit-verifier")
+	if err != nil {
+		logging.Fatal("failed to configure logging", "error", err)
+	}
+
+	logger.Info("CF Audit Log Verification Start", "version", version, "git_commit", gitCommit)
+
+	key := audit.DefaultKey
+	if *keyFile != "" {
+		if key, err = audit.LoadKey(*keyFile); err != nil {
+			logging.Fatal("failed to load audit key", "error", err)
+		}
+	}
+
+	var head audit.Head
+	var count int
+	if *expectHead != "" {
+		expected, err := audit.ParseHead(*expectHead)
+		if err != nil {
+			logging.Fatal("invalid head", "error", err)
+		}
+		head, count, err = audit.CheckHead(*file, key, expected)
+	} else {
+		head, count, err = audit.Verify(*file, key)
+	}
+	if err != nil {
+		logging.Fatal("audit log verification failed", "file", *file, "events", count, "error", err)
+	}
+
+	logger.Info("audit log verification successful, chain intact", "file", *file, "events", count, "head", head.String())
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/logging"
+	"github.com/chenwes/licensemodule/pkg/client"
+	"github.com/chenwes/licensemodule/pkg/utils"
+)
+
+// 版本信息，通过 ldflags 在编译时注入
+var (
+	version   = "unknown"
+	gitCommit = "unknown"
+)
+
+// This program exchanges an activation code for a license bound to the current machine
+
+func main() {
+	// Define command line parameters
+	server := flag.String("server", "http://localhost:8080", "License server URL")
+	code := flag.String("code", "", "Activation code")
+	licFile := flag.String("license", license.DefaultLicenseFile, "Where to save the license file")
+	container := flag.Bool("container", false, "Whether running in container environment")
+	deactivate := flag.Bool("deactivate", false, "Release the activation of this machine and remove its license file instead of activating")
+	timeout := flag.Duration("timeout", 30*time.Second, "Request timeout")
+	logFormat := flag.String("log-format", logging.FormatText, "Log format: text or json")
+	flag.Parse()
+
+	// Configure logging
+	logger, err := logging.Setup(*logFormat, "info", "license-activate")
+	if err != nil {
+		logging.Fatal("failed to configure logging", "error", err)
+	}
+
+	logger.Info("CF License Activation Start", "version", version, "git_commit", gitCommit)
+
+	if *code == "" {
+		logging.Fatal("activation code is required")
+	}
+
+	// Get current machine ID
+	var machineID string
+	if *container {
+		machineID, err = utils.GetContainerizedMachineID()
+	} else {
+		machineID, err = utils.GetMachineID()
+	}
+	if err != nil {
+		logging.Fatal("failed to get machine ID", "error", err)
+	}
+	logger.Info("current machine ID", "machine_id", machineID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	c := client.New(*server, "")
+
+	licFilePath, err := filepath.Abs(*licFile)
+	if err != nil {
+		logging.Fatal("failed to get absolute path for license file", "error", err)
+	}
+
+	if *deactivate {
+		if err := c.Deactivate(ctx, *code, machineID); err != nil {
+			logging.Fatal("deactivation failed", "error", err)
+		}
+		// The license would otherwise keep working offline until it expires
+		if err := os.Remove(licFilePath); err != nil && !os.IsNotExist(err) {
+			logging.Fatal("failed to remove license", "license", licFilePath, "error", err)
+		}
+		logger.Info("deactivation successful, the activation can now be used on another machine",
+			"removed", licFilePath)
+		return
+	}
+
+	data, err := c.Activate(ctx, *code, machineID)
+	if err != nil {
+		logging.Fatal("activation failed", "error", err)
+	}
+
+	// Decode the returned license to check it and show its details
+	lic, err := license.Decode(data)
+	if err != nil {
+		logging.Fatal("invalid license returned by server", "error", err)
+	}
+
+	if err := os.WriteFile(licFilePath, data, 0644); err != nil {
+		logging.Fatal("failed to save license", "error", err)
+	}
+
+	logger.Info("activation successful",
+		"serial", lic.Serial,
+		"app_id", lic.AppID,
+		"expiry_date", lic.ExpiryDate.Format("2006-01-02 15:04:05"),
+		"features", lic.Features,
+		"license", licFilePath,
+	)
+}
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/chenwes/licensemodule/internal/audit"
+	"github.com/chenwes/licensemodule/internal/catalog"
 	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/logging"
 	"github.com/chenwes/licensemodule/pkg/utils"
 )
 
@@ -28,79 +34,321 @@ func main() {
 	outFile := flag.String("out", license.DefaultLicenseFile, "Output file path")
 	container := flag.Bool("container", false, "Whether to generate license for container environment")
 	features := flag.String("features", "", "Optional feature list, comma separated")
+	seats := flag.Int("seats", 0, "Issue a floating license with this many concurrent seats, for the license server's machine")
+	maxCores := flag.Int("max-cores", 0, "Maximum CPU cores of the licensed machine, 0 for unlimited")
+	maxUsers := flag.Int("max-users", 0, "Maximum users of the application, 0 for unlimited")
+	maxInstances := flag.Int("max-instances", 0, "Maximum running instances of the application, 0 for unlimited")
+	edition := flag.String("edition", "", "Catalog edition, expands to the features, validity and limits of the edition; -features are added and explicit -days and limits take precedence")
+	apps := flag.String("apps", "", "Further applications covered by the license, app IDs or glob patterns such as cf.suite.*, comma separated")
+	appFeatures := flag.String("app-features", "", "Extra features by app ID or pattern, e.g. \"cf.suite.mes=report,export;cf.suite.wms=scan\"")
+	minVersion := flag.String("min-version", "", "Lowest application version covered by the license, e.g. 2 or 2.1.0")
+	maxVersion := flag.String("max-version", "", "Highest application version covered by the license; partial versions like 2.x cover every matching version")
+	customerName := flag.String("customer", "", "Customer name")
+	customerID := flag.String("customer-id", "", "Customer ID")
+	contract := flag.String("contract", "", "Contract or order number")
+	email := flag.String("email", "", "Contact email of the customer")
+	metadata := flag.String("metadata", "", "Free-form metadata, e.g. \"region=emea,reseller=acme\"")
+	bindingType := flag.String("binding", license.BindMachine, "What the license is bound to: machine, host, network or unbound (needs -max-instances)")
+	hostnames := flag.String("hostnames", "", "Hostnames or *.domain patterns of a host binding, comma separated")
+	networks := flag.String("networks", "", "CIDRs of a network binding, comma separated")
+	catalogFile := flag.String("catalog", "catalog.yaml", "Product catalog file used with -edition")
+	renewFile := flag.String("renew", "", "License file to renew: -days are added to its expiry and -features to its features, the new license records its serial")
+	trialPolicy := flag.String("trial-policy", "", "Write a signed trial policy for -app, -days, -features and the limits to this file instead of a license")
 	showMachineID := flag.Bool("show-id", false, "Only show current machine ID, don't generate license")
+	encrypt := flag.Bool("encrypt", false, "Encrypt the license file with the key of the application derived from -encryption-key, not possible with -apps")
+	encryptionKeyFile := flag.String("encryption-key", "", "File holding the master key of encrypted licenses")
+	showAppKey := flag.Bool("show-app-key", false, "Only show the hex encoded encryption key of -app, to be compiled into the application")
+	requestFile := flag.String("request", "", "Offline activation request file, or its compact encoding, to issue the license for")
+	auditFile := flag.String("audit", audit.DefaultFile, "Audit log file path")
+	auditKeyFile := flag.String("audit-key", "", "File holding the key of the audit log hash chain, the builtin key when empty")
+	actor := flag.String("actor", currentUser(), "Name of the person issuing the license, recorded in the audit log")
+	logFormat := flag.String("log-format", logging.FormatText, "Log format: text or json")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
 	flag.Parse()
 
 	// Configure logging
-	log.SetPrefix("[LicenseGenerator] ")
+	logger, err := logging.Setup(*logFormat, *logLevel, "license-generator")
+	if err != nil {
+		logging.Fatal("failed to configure logging", "error", err)
+	}
+	license.SetLogger(logger)
 
-	log.Printf("CF License Generation Service Start: Version: %s, Git Commit: %s", version, gitCommit)
+	logger.Info("CF License Generation Service Start", "version", version, "git_commit", gitCommit)
 
 	// If only showing machine ID
 	if *showMachineID {
 		id, err := getMachineID(*container)
 		if err != nil {
-			log.Fatalf("Failed to get machine ID: %v", err)
+			logging.Fatal("failed to get machine ID", "error", err)
 		}
 		fmt.Printf("Current machine ID: %s\n", id)
 		return
 	}
 
+	// Load the master key of encrypted licenses
+	if *encryptionKeyFile != "" {
+		key, err := license.LoadEncryptionKey(*encryptionKeyFile)
+		if err != nil {
+			logging.Fatal("failed to load encryption key", "error", err)
+		}
+		license.SetEncryptionKey(key)
+		if *showAppKey {
+			fmt.Printf("Encryption key of %s: %s\n", *appID, hex.EncodeToString(license.AppEncryptionKey(key, *appID)))
+			return
+		}
+	}
+	if *showAppKey {
+		logging.Fatal("-show-app-key needs -encryption-key")
+	}
+	if *encrypt {
+		if err := license.CheckEncryptionKey(*appID); err != nil {
+			logging.Fatal("cannot encrypt license, use -encryption-key", "error", err)
+		}
+	}
+
+	// Parse feature list
+	var featureList []string
+	if *features != "" {
+		featureList = strings.Split(*features, ",")
+	}
+
+	limits := license.Limits{MaxCores: *maxCores, MaxUsers: *maxUsers, MaxInstances: *maxInstances}
+	if err := limits.Validate(); err != nil {
+		logging.Fatal("invalid limits", "error", err)
+	}
+
+	// Write a trial policy to be compiled into the application
+	if *trialPolicy != "" {
+		writeTrialPolicy(logger, *trialPolicy, *appID, *days, featureList, limits)
+		return
+	}
+
+	auditLog := openAuditLog(logger, *auditFile, *auditKeyFile)
+
+	// Renew an existing license instead of issuing a new one
+	if *renewFile != "" {
+		data, err := os.ReadFile(*renewFile)
+		if err != nil {
+			logging.Fatal("failed to load license", "error", err)
+		}
+		prev, err := license.Decode(data)
+		if err != nil {
+			logging.Fatal("failed to load license", "error", err)
+		}
+		lic, err := license.Renew(prev, *days, featureList, *actor)
+		if err != nil {
+			logging.Fatal("failed to renew license", "error", err)
+		}
+		logger.Info("license renewed", "previous_serial", prev.Serial, "original_serial", lic.OriginalSerial)
+		// The renewal of an encrypted license is encrypted as well
+		saveLicense(logger, lic, *outFile, *encrypt || license.IsEncrypted(data), auditLog, audit.Event{
+			Action: audit.ActionRenew,
+			Actor:  *actor,
+			Details: map[string]string{
+				"tool":            "cf-license-generate",
+				"previous_serial": prev.Serial,
+				"days":            strconv.Itoa(*days),
+			},
+		})
+		return
+	}
+
+	binding := license.Binding{BindingType: *bindingType}
+	if *hostnames != "" {
+		binding.Hostnames = strings.Split(*hostnames, ",")
+	}
+	if *networks != "" {
+		binding.Networks = strings.Split(*networks, ",")
+	}
+	if binding.Type() == license.BindMachine {
+		binding.BindingType = ""
+	}
+
 	// Get machine ID
 	var id string
-	var err error
-	if *machineID == "" {
+	var req *license.ActivationRequest
+	if binding.Type() != license.BindMachine {
+		// Hostname, network and unbound licenses have no machine ID
+		if *requestFile != "" || *machineID != "" || *seats > 0 {
+			logging.Fatal("-request, -machine and -seats need a machine binding", "binding", binding.Type())
+		}
+		logger.Info("license is not bound to a machine", "binding", binding.Type(),
+			"hostnames", binding.Hostnames, "networks", binding.Networks)
+	} else if *requestFile != "" {
+		// Use the machine, application and requested features of an offline activation request
+		req, err = loadRequest(*requestFile)
+		if err != nil {
+			logging.Fatal("failed to load activation request", "error", err)
+		}
+		if err := req.Verify(); err != nil {
+			logging.Fatal("activation request rejected", "error", err)
+		}
+		if *appID != "" && *appID != req.AppID {
+			logging.Fatal("activation request is for another application", "app_id", req.AppID)
+		}
+		id = req.MachineID
+		*appID = req.AppID
+		if featureList == nil {
+			featureList = req.Features
+		}
+		logger.Info("using activation request", "machine_id", id, "app_id", req.AppID,
+			"requested_features", req.Features, "created_at", req.CreatedAt.Format(time.RFC3339))
+	} else if *machineID == "" {
 		// Use current machine's ID
 		id, err = getMachineID(*container)
 		if err != nil {
-			log.Fatalf("Failed to get machine ID: %v", err)
+			logging.Fatal("failed to get machine ID", "error", err)
 		}
-		log.Printf("Using current machine ID: %s", id)
+		logger.Info("using current machine ID", "machine_id", id)
 	} else {
 		// Use provided machine ID
 		id = *machineID
-		log.Printf("Using provided machine ID: %s", id)
+		logger.Info("using provided machine ID", "machine_id", id)
 	}
 
-	// Parse feature list
-	var featureList []string
-	if *features != "" {
-		featureList = strings.Split(*features, ",")
+	// Expand the edition from the product catalog
+	var cat *catalog.Catalog
+	if *edition != "" {
+		cat, err = catalog.Load(*catalogFile)
+		if err != nil {
+			logging.Fatal("failed to load catalog", "error", err)
+		}
+
+		requested := catalog.Entitlements{Features: featureList, Limits: limits}
+		if flagSet("days") {
+			requested.Days = *days
+		}
+		ent, err := cat.Expand(*appID, *edition, requested)
+		if err != nil {
+			logging.Fatal("failed to expand edition", "error", err)
+		}
+		featureList, limits = ent.Features, ent.Limits
+		if ent.Days > 0 {
+			*days = ent.Days
+		}
+		logger.Info("edition expanded", "edition", *edition, "catalog_version", cat.Version,
+			"features", featureList, "days", *days)
 	}
 
-	// Create License
-	lic, err := license.NewLicense(id, *appID, *days, featureList)
+	// Create License, a floating one when seats are given
+	var lic *license.License
+	switch {
+	case binding.Type() != license.BindMachine:
+		lic, err = license.NewBoundLicense(binding, *appID, *days, featureList, limits)
+	case *seats > 0:
+		lic, err = license.NewFloatingLicense(id, *appID, *days, featureList, *seats)
+	default:
+		lic, err = license.NewLicense(id, *appID, *days, featureList)
+	}
+	if err == nil && (*edition != "" || !limits.IsZero()) {
+		lic.Edition = *edition
+		lic.Limits = limits
+		err = lic.Sign()
+	}
+	if err == nil && (*apps != "" || *appFeatures != "") {
+		err = setApps(lic, *apps, *appFeatures)
+	}
+	if err == nil && (*minVersion != "" || *maxVersion != "") {
+		err = lic.SetVersionRange(*minVersion, *maxVersion)
+	}
+	if err == nil {
+		customer := license.Customer{
+			CustomerName: *customerName,
+			CustomerID:   *customerID,
+			Contract:     *contract,
+			ContactEmail: *email,
+			IssuedBy:     *actor,
+		}
+		customer.Metadata, err = parseMetadata(*metadata)
+		if err == nil {
+			err = lic.SetCustomer(customer)
+		}
+	}
 	if err != nil {
-		log.Fatalf("Failed to create license: %v", err)
+		logging.Fatal("failed to create license", "error", err)
+	}
+
+	details := map[string]string{"tool": "cf-license-generate"}
+	if req != nil {
+		details["request_nonce"] = req.Nonce
 	}
+	if cat != nil {
+		details["edition"] = lic.Edition
+		details["catalog_version"] = strconv.Itoa(cat.Version)
+	}
+	saveLicense(logger, lic, *outFile, *encrypt, auditLog, audit.Event{
+		Action:  audit.ActionGenerate,
+		Actor:   *actor,
+		Details: details,
+	})
+}
 
+// Display the license, record event for it in the audit log and save it,
+// encrypted if requested. The license is only written once it is audited.
+func saveLicense(logger *slog.Logger, lic *license.License, outFile string, encrypt bool, auditLog *audit.Log, event audit.Event) {
 	// Display License information
-	log.Printf("License created:")
-	log.Printf("  Machine ID: %s", lic.MachineID)
-	log.Printf("  App ID: %s", lic.AppID)
-	log.Printf("  Expiry Date: %s", lic.ExpiryDate.Format(time.RFC3339))
-	log.Printf("  Features: %v", lic.Features)
-	log.Printf("  Creation Date: %s", lic.CreationDate.Format(time.RFC3339))
+	logger.Info("license created",
+		"serial", lic.Serial,
+		"machine_id", lic.MachineID,
+		"app_id", lic.AppID,
+		"expiry_date", lic.ExpiryDate.Format(time.RFC3339),
+		"features", lic.Features,
+		"seats", lic.Seats,
+		"edition", lic.Edition,
+		"app_ids", lic.AppIDs,
+		"binding", lic.Binding.Type(),
+		"min_version", lic.MinVersion,
+		"max_version", lic.MaxVersion,
+		"customer_name", lic.CustomerName,
+		"customer_id", lic.CustomerID,
+		"contract", lic.Contract,
+		"max_cores", lic.MaxCores,
+		"max_users", lic.MaxUsers,
+		"max_instances", lic.MaxInstances,
+		"creation_date", lic.CreationDate.Format(time.RFC3339),
+	)
+
+	// Check before auditing, a license that is audited must be saved
+	if encrypt && len(lic.AppIDs) > 0 {
+		logging.Fatal("cannot encrypt license", "error", license.ErrMultiAppEncryption)
+	}
 
 	// Save to file
-	absPath, err := filepath.Abs(*outFile)
+	absPath, err := filepath.Abs(outFile)
 	if err != nil {
-		log.Printf("Warning: Cannot get absolute path: %v", err)
-		absPath = *outFile
+		logger.Warn("cannot get absolute path", "path", outFile, "error", err)
+		absPath = outFile
 	}
 
 	// Ensure directory exists
 	dir := filepath.Dir(absPath)
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			log.Printf("Warning: Cannot create directory: %v", err)
+			logger.Warn("cannot create directory", "dir", dir, "error", err)
 		}
 	}
 
-	if err := lic.Save(*outFile); err != nil {
-		log.Fatalf("Failed to save license: %v", err)
+	// Record the issuance in the audit log
+	expiry := lic.ExpiryDate
+	event.Serial = lic.Serial
+	event.MachineID = lic.MachineID
+	event.AppID = lic.AppID
+	event.Features = lic.Features
+	event.ExpiryDate = &expiry
+	event.Details["out"] = absPath
+	if err := auditLog.Append(event); err != nil {
+		logging.Fatal("failed to write audit log", "error", err)
+	}
+	logger.Info("audit event written", "path", auditLog.Path())
+
+	save := lic.Save
+	if encrypt {
+		save = lic.SaveEncrypted
+	}
+	if err := save(outFile); err != nil {
+		logging.Fatal("failed to save license", "error", err)
 	}
-	log.Printf("License saved to: %s", absPath)
+	logger.Info("license saved", "path", absPath, "encrypted", encrypt)
 
 	// Print license in JSON format (optional, for debugging)
 	jsonData, _ := json.MarshalIndent(lic, "", "  ")
@@ -108,6 +356,107 @@ func main() {
 	fmt.Println(string(jsonData))
 }
 
+// Write a signed trial policy, the application embeds it and starts the
+// trial on first run
+func writeTrialPolicy(logger *slog.Logger, path, appID string, days int, features []string, limits license.Limits) {
+	policy, err := license.NewTrialPolicy(appID, days, features, limits)
+	if err != nil {
+		logging.Fatal("failed to create trial policy", "error", err)
+	}
+	data, err := policy.Encode()
+	if err != nil {
+		logging.Fatal("failed to encode trial policy", "error", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		logging.Fatal("failed to save trial policy", "error", err)
+	}
+	logger.Info("trial policy saved", "path", path, "app_id", policy.AppID, "days", policy.Days, "features", policy.Features)
+}
+
+// Let the license cover further applications. appFeatures lists the
+// features of each app ID or pattern as app=feature,feature;app=feature.
+func setApps(lic *license.License, apps, appFeatures string) error {
+	var appIDs []string
+	if apps != "" {
+		appIDs = strings.Split(apps, ",")
+	}
+
+	var features map[string][]string
+	if appFeatures != "" {
+		features = make(map[string][]string)
+		for _, entry := range strings.Split(appFeatures, ";") {
+			app, list, ok := strings.Cut(entry, "=")
+			if !ok || app == "" || list == "" {
+				return fmt.Errorf("invalid app features %q, expected app=feature,feature", entry)
+			}
+			features[app] = strings.Split(list, ",")
+		}
+	}
+	return lic.SetApps(appIDs, features)
+}
+
+// Parse metadata given as key=value,key=value
+func parseMetadata(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	metadata := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid metadata %q, expected key=value", item)
+		}
+		metadata[key] = value
+	}
+	return metadata, nil
+}
+
+// Load an activation request from a file, or from the argument itself when
+// it is the compact encoding pasted from a QR code
+func loadRequest(arg string) (*license.ActivationRequest, error) {
+	if strings.HasPrefix(arg, license.CompactRequestPrefix) {
+		return license.ParseActivationRequest([]byte(arg))
+	}
+	return license.LoadActivationRequest(arg)
+}
+
+// Report whether a flag was given on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// Open the audit log with the key from keyFile, or the builtin key
+func openAuditLog(logger *slog.Logger, path, keyFile string) *audit.Log {
+	key := audit.DefaultKey
+	if keyFile != "" {
+		var err error
+		if key, err = audit.LoadKey(keyFile); err != nil {
+			logging.Fatal("failed to load audit key", "error", err)
+		}
+	} else {
+		logger.Debug("using the builtin audit key, pass -audit-key in production")
+	}
+	auditLog, err := audit.Open(path, key)
+	if err != nil {
+		logging.Fatal("failed to open audit log", "error", err)
+	}
+	return auditLog
+}
+
+// Get the name of the current OS user for the audit log
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
 // Get machine ID based on environment type
 func getMachineID(isContainer bool) (string, error) {
 	if isContainer {
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"encoding/hex"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/logging"
 	"github.com/chenwes/licensemodule/pkg/utils"
 )
 
@@ -21,59 +25,188 @@ var (
 func main() {
 	// Define command line parameters
 	licFile := flag.String("license", license.DefaultLicenseFile, "License file path")
+	licDir := flag.String("dir", "", "Directory of license files (*.dat) to find the license of -app in, instead of -license")
 	timeFile := flag.String("timestamp", license.TimeStampFile, "Timestamp file path")
 	container := flag.Bool("container", false, "Whether running in container environment")
 	appID := flag.String("app", "", "Application ID")
+	logFormat := flag.String("log-format", logging.FormatText, "Log format: text or json")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	users := flag.Int("users", 0, "Number of users to check against the user limit of the license")
+	instances := flag.Int("instances", 0, "Number of instances to check against the instance limit of the license, required for unbound licenses")
+	appVersion := flag.String("app-version", "", "Application version to check against the version range of the license, required when the license has one")
+	rejectSuperseded := flag.Bool("reject-superseded", false, "Fail when a newer renewal of the license has been verified on this machine before")
+	requestFile := flag.String("request", "", "Write an offline activation request for -app to this file instead of verifying")
+	features := flag.String("features", "", "Requested features for the activation request, comma separated")
+	compact := flag.Bool("compact", false, "Also print the activation request in the compact, QR friendly encoding")
+	encryptionKeyFile := flag.String("encryption-key", "", "File holding the master key, to verify encrypted licenses")
+	appKey := flag.String("app-key", "", "Hex encoded encryption key of -app, as shown by the generator's -show-app-key, to verify encrypted licenses. Encrypted licenses only cover the app they were issued for.")
 	flag.Parse()
 
 	// Configure logging
-	log.SetPrefix("[LicenseVerifier] ")
+	logger, err := logging.Setup(*logFormat, *logLevel, "license-verifier")
+	if err != nil {
+		logging.Fatal("failed to configure logging", "error", err)
+	}
+	license.SetLogger(logger)
 
-	log.Printf("CF License Verification Service Start: Version: %s, Git Commit: %s", version, gitCommit)
+	logger.Info("CF License Verification Service Start", "version", version, "git_commit", gitCommit)
+
+	// Create an offline activation request for air-gapped machines
+	if *requestFile != "" {
+		writeRequest(logger, *requestFile, *container, *appID, *features, *compact)
+		return
+	}
+
+	// Load the keys of encrypted licenses
+	if *encryptionKeyFile != "" {
+		key, err := license.LoadEncryptionKey(*encryptionKeyFile)
+		if err != nil {
+			logging.Fatal("failed to load encryption key", "error", err)
+		}
+		license.SetEncryptionKey(key)
+	}
+	if *appKey != "" {
+		key, err := hex.DecodeString(*appKey)
+		if err != nil {
+			logging.Fatal("invalid app key", "error", err)
+		}
+		license.SetAppEncryptionKey(*appID, key)
+	}
 
 	// Get current machine ID
 	machineID, err := getMachineID(*container)
 	if err != nil {
-		log.Fatalf("Failed to get machine ID: %v", err)
+		logging.Fatal("failed to get machine ID", "error", err)
 	}
-	log.Printf("Current machine ID: %s", machineID)
+	logger.Info("current machine ID", "machine_id", machineID)
 
 	// Ensure file paths are absolute
-	licFilePath, err := filepath.Abs(*licFile)
+	timeFilePath, err := filepath.Abs(*timeFile)
 	if err != nil {
-		log.Fatalf("Failed to get absolute path for license file: %v", err)
+		logging.Fatal("failed to get absolute path for timestamp file", "error", err)
 	}
 
-	timeFilePath, err := filepath.Abs(*timeFile)
+	// Perform verification
+	var lic *license.License
+	if *licDir != "" {
+		lic = findLicense(logger, *licDir, timeFilePath, machineID, *appID, *users, *instances)
+	} else {
+		lic = verifyFile(logger, *licFile, timeFilePath, machineID, *appID, *users, *instances)
+	}
+
+	// Check the application version against the version range. The version
+	// of this tool says nothing about the application, so it must be given.
+	if lic.MinVersion != "" || lic.MaxVersion != "" {
+		if *appVersion == "" {
+			logging.Fatal("license is limited to a version range, pass -app-version",
+				"min_version", lic.MinVersion, "max_version", lic.MaxVersion)
+		}
+		if err := lic.CheckVersion(*appVersion); err != nil {
+			logging.Fatal("license verification failed", "error", err)
+		}
+	}
+
+	// Reject going back to an older license of the renewal chain
+	if *rejectSuperseded {
+		if err := lic.CheckLatest(timeFilePath); err != nil {
+			logging.Fatal("license verification failed", "error", err)
+		}
+	}
+
+	logger.Info("license verification successful",
+		"serial", lic.Serial,
+		"machine_id", lic.MachineID,
+		"binding", lic.Binding.Type(),
+		"hostnames", lic.Hostnames,
+		"networks", lic.Networks,
+		"app_id", lic.AppID,
+		"expiry_date", lic.ExpiryDate.Format("2006-01-02 15:04:05"),
+		"features", lic.FeaturesFor(*appID),
+		"edition", lic.Edition,
+		"previous_serial", lic.PreviousSerial,
+		"min_version", lic.MinVersion,
+		"max_version", lic.MaxVersion,
+		"customer_name", lic.CustomerName,
+		"customer_id", lic.CustomerID,
+		"contract", lic.Contract,
+		"contact_email", lic.ContactEmail,
+		"issued_by", lic.IssuedBy,
+		"creation_date", lic.CreationDate.Format("2006-01-02 15:04:05"),
+		"max_cores", lic.MaxCores,
+		"max_users", lic.MaxUsers,
+		"max_instances", lic.MaxInstances,
+	)
+	for _, key := range lic.MetadataKeys() {
+		logger.Info("license metadata", "key", key, "value", lic.Metadata[key])
+	}
+}
+
+// Verify a license file
+func verifyFile(logger *slog.Logger, licFile, timeFilePath, machineID, appID string, users, instances int) *license.License {
+	licFilePath, err := filepath.Abs(licFile)
 	if err != nil {
-		log.Fatalf("Failed to get absolute path for timestamp file: %v", err)
+		logging.Fatal("failed to get absolute path for license file", "error", err)
 	}
 
 	// Check if file exists
 	if _, err := os.Stat(licFilePath); os.IsNotExist(err) {
-		log.Fatalf("License file does not exist: %s", licFilePath)
+		logging.Fatal("license file does not exist", "path", licFilePath)
 	}
 
-	// Perform verification
-	log.Printf("Starting license verification...")
-	err = license.VerifyAndUpdate(licFilePath, timeFilePath, machineID, *appID)
+	logger.Info("starting license verification", "license", licFilePath, "timestamp", timeFilePath)
+	err = license.VerifyUsageAndUpdate(licFilePath, timeFilePath, machineID, appID, users, instances)
 	if err != nil {
-		log.Fatalf("License verification failed: %v", err)
+		logging.Fatal("license verification failed", "error", err)
 	}
 
 	// Load license to display more information
 	lic, err := license.Load(licFilePath)
 	if err != nil {
-		log.Fatalf("Failed to load license: %v", err)
+		logging.Fatal("failed to load license", "error", err)
+	}
+	return lic
+}
+
+// Find and verify the license of the application in a directory holding
+// the licenses of several applications
+func findLicense(logger *slog.Logger, dir, timeFilePath, machineID, appID string, users, instances int) *license.License {
+	logger.Info("looking for license", "dir", dir, "app_id", appID, "timestamp", timeFilePath)
+	ctx := license.LocalBinding(machineID)
+	ctx.Instances = instances
+	lic, err := license.LoadForAppBinding(dir, timeFilePath, ctx, appID)
+	if err == nil {
+		err = lic.CheckUsage(users, instances)
+	}
+	if err != nil {
+		logging.Fatal("license verification failed", "error", err)
 	}
+	return lic
+}
+
+// Write a signed activation request for the current machine
+func writeRequest(logger *slog.Logger, path string, container bool, appID, features string, compact bool) {
+	var featureList []string
+	if features != "" {
+		featureList = strings.Split(features, ",")
+	}
+
+	req, err := license.NewMachineActivationRequest(container, appID, featureList)
+	if err != nil {
+		logging.Fatal("failed to create activation request", "error", err)
+	}
+	if err := req.Save(path); err != nil {
+		logging.Fatal("failed to save activation request", "error", err)
+	}
+	logger.Info("activation request saved, send it to the vendor to receive a license",
+		"path", path, "machine_id", req.MachineID, "app_id", req.AppID)
 
-	log.Printf("License verification successful!")
-	log.Printf("License details:")
-	log.Printf("  Machine ID: %s", lic.MachineID)
-	log.Printf("  App ID: %s", lic.AppID)
-	log.Printf("  Expiry Date: %s", lic.ExpiryDate.Format("2006-01-02 15:04:05"))
-	log.Printf("  Features: %v", lic.Features)
-	log.Printf("  Creation Date: %s", lic.CreationDate.Format("2006-01-02 15:04:05"))
+	if compact {
+		code, err := req.EncodeCompact()
+		if err != nil {
+			logging.Fatal("failed to encode activation request", "error", err)
+		}
+		fmt.Println(code)
+	}
 }
 
 // Get machine ID based on environment type
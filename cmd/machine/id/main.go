@@ -3,23 +3,60 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
+	"strings"
 
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/logging"
 	"github.com/chenwes/licensemodule/pkg/utils"
 )
 
 func main() {
 	// Define command line parameters
 	container := flag.Bool("container", false, "Whether running in container environment")
+	requestFile := flag.String("request", "", "Write an offline activation request to this file")
+	compact := flag.Bool("compact", false, "Print the offline activation request in the compact, QR friendly encoding")
+	appID := flag.String("app", "", "Application ID for the activation request")
+	features := flag.String("features", "", "Requested features for the activation request, comma separated")
+	logFormat := flag.String("log-format", logging.FormatText, "Log format: text or json")
 	flag.Parse()
 
 	// Configure logging
-	log.SetPrefix("[MachineID] ")
+	logger, err := logging.Setup(*logFormat, "info", "machine-id")
+	if err != nil {
+		logging.Fatal("failed to configure logging", "error", err)
+	}
+
+	// Create an offline activation request
+	if *requestFile != "" || *compact {
+		var featureList []string
+		if *features != "" {
+			featureList = strings.Split(*features, ",")
+		}
+
+		req, err := license.NewMachineActivationRequest(*container, *appID, featureList)
+		if err != nil {
+			logging.Fatal("failed to create activation request", "error", err)
+		}
+		if *requestFile != "" {
+			if err := req.Save(*requestFile); err != nil {
+				logging.Fatal("failed to save activation request", "error", err)
+			}
+			logger.Info("activation request saved", "path", *requestFile, "machine_id", req.MachineID, "app_id", req.AppID)
+		}
+		if *compact {
+			code, err := req.EncodeCompact()
+			if err != nil {
+				logging.Fatal("failed to encode activation request", "error", err)
+			}
+			fmt.Println(code)
+		}
+		return
+	}
 
 	// Get machine ID
 	id, err := getMachineID(*container)
 	if err != nil {
-		log.Fatalf("Failed to get machine ID: %v", err)
+		logging.Fatal("failed to get machine ID", "error", err)
 	}
 	fmt.Printf("Current machine ID: %s\n", id)
 }
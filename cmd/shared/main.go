@@ -34,6 +34,71 @@ func VerifyLicense(licenseFile, timestampFile, machineID, appID *C.char) *C.char
 	return C.CString("ok")
 }
 
+//export VerifyLicenseUsage
+func VerifyLicenseUsage(licenseFile, timestampFile, machineID, appID *C.char, users, instances C.int) *C.char {
+	err := license.VerifyUsageAndUpdate(
+		C.GoString(licenseFile),
+		C.GoString(timestampFile),
+		C.GoString(machineID),
+		C.GoString(appID),
+		int(users),
+		int(instances),
+	)
+	if err != nil {
+		return C.CString(err.Error())
+	}
+	return C.CString("ok")
+}
+
+//export VerifyLicenseVersion
+func VerifyLicenseVersion(licenseFile, timestampFile, machineID, appID, appVersion *C.char) *C.char {
+	err := license.VerifyVersionAndUpdate(
+		C.GoString(licenseFile),
+		C.GoString(timestampFile),
+		C.GoString(machineID),
+		C.GoString(appID),
+		C.GoString(appVersion),
+	)
+	if err != nil {
+		return C.CString(err.Error())
+	}
+	return C.CString("ok")
+}
+
+//export VerifyLicenseForApp
+func VerifyLicenseForApp(licenseDir, timestampFile, machineID, appID *C.char) *C.char {
+	_, err := license.LoadForApp(
+		C.GoString(licenseDir),
+		C.GoString(timestampFile),
+		C.GoString(machineID),
+		C.GoString(appID),
+	)
+	if err != nil {
+		return C.CString(err.Error())
+	}
+	return C.CString("ok")
+}
+
+//export VerifyLicenseOrTrial
+func VerifyLicenseOrTrial(licenseFile, timestampFile, trialFile, machineID, trialPolicy *C.char) *C.char {
+	policy, err := license.ParseTrialPolicy([]byte(C.GoString(trialPolicy)))
+	if err != nil {
+		return C.CString(err.Error())
+	}
+
+	_, err = license.VerifyOrTrial(
+		C.GoString(licenseFile),
+		C.GoString(timestampFile),
+		C.GoString(trialFile),
+		C.GoString(machineID),
+		policy,
+	)
+	if err != nil {
+		return C.CString(err.Error())
+	}
+	return C.CString("ok")
+}
+
 //export GenerateLicense
 func GenerateLicense(machineID, appID *C.char, days C.int, outFile *C.char) *C.char {
 	lic, err := license.NewLicense(
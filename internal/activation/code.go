@@ -0,0 +1,65 @@
+package activation
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+// codeBytes is the amount of randomness in an activation code, 120 bits
+// encode to 24 base32 characters without padding
+const codeBytes = 15
+
+// groupSize is the number of characters between dashes in a formatted code
+const groupSize = 6
+
+// NewCode returns a random activation code such as
+// "ABCDEF-GHIJKL-MNOPQR-STUVWX"
+func NewCode() (string, error) {
+	b := make([]byte, codeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return format(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)), nil
+}
+
+// Normalize removes dashes and whitespace and upper-cases the code, so codes
+// typed by hand in any format match
+func Normalize(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '\t', '\r', '\n':
+			return -1
+		}
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return r
+	}, code)
+}
+
+// Hash returns the hex SHA-256 of the normalized code. It identifies a code
+// without revealing it, e.g. in file names and audit logs.
+func Hash(code string) string {
+	sum := sha256.Sum256([]byte(Normalize(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// ID returns a short identifier of the code that is safe to log
+func ID(code string) string {
+	return Hash(code)[:16]
+}
+
+// format inserts a dash every groupSize characters
+func format(code string) string {
+	var b strings.Builder
+	for i, r := range code {
+		if i > 0 && i%groupSize == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
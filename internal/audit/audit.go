@@ -0,0 +1,340 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audited actions
+const (
+	ActionGenerate    = "generate"
+	ActionRenew       = "renew"
+	ActionRevoke      = "revoke"
+	ActionActivate    = "activate"
+	ActionDeactivate  = "deactivate"
+	ActionCreateCode  = "create_activation_code"
+	ActionKeyRotation = "key_rotation"
+)
+
+// DefaultFile is the default audit log file name
+const DefaultFile = "audit.log"
+
+var (
+	// ErrChainBroken is returned when the hash chain of an audit log does not verify
+	ErrChainBroken = errors.New("audit log hash chain is broken")
+	ErrNoKey       = errors.New("audit key cannot be empty")
+)
+
+// DefaultKey keys the hash chain when no audit key is configured. Anyone
+// knowing the key can rewrite a log, so production setups should load their
+// own key with LoadKey.
+var DefaultKey = []byte("c6f3b8e41d9a27f05e8b13c4a7d2690f/CF/AUDIT")
+
+// Event is one line of the audit log. Hash is an HMAC over every other
+// field, including PrevHash, so changing or removing a line breaks the chain
+// and lines cannot be forged without the key.
+type Event struct {
+	Seq        uint64            `json:"seq"`
+	Time       time.Time         `json:"time"`
+	Action     string            `json:"action"`
+	Actor      string            `json:"actor"`
+	Serial     string            `json:"serial,omitempty"`
+	MachineID  string            `json:"machine_id,omitempty"`
+	AppID      string            `json:"app_id,omitempty"`
+	Features   []string          `json:"features,omitempty"`
+	ExpiryDate *time.Time        `json:"expiry_date,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+	PrevHash   string            `json:"prev_hash"`
+	Hash       string            `json:"hash"`
+}
+
+// Head identifies the last event of a log. Recording it elsewhere, e.g. in
+// the server log, lets CheckHead detect a log that was cut off or rewritten.
+type Head struct {
+	Seq  uint64
+	Hash string
+}
+
+// String returns the head as seq:hash
+func (h Head) String() string {
+	return strconv.FormatUint(h.Seq, 10) + ":" + h.Hash
+}
+
+// ParseHead parses a head in the seq:hash form
+func ParseHead(s string) (Head, error) {
+	seq, hash, ok := strings.Cut(s, ":")
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if !ok || err != nil || hash == "" {
+		return Head{}, fmt.Errorf("invalid audit log head %q, expected seq:hash", s)
+	}
+	return Head{Seq: n, Hash: hash}, nil
+}
+
+// Log is an append-only, HMAC-chained JSON-lines audit log. Appends lock
+// the file and continue from its last line, so several processes, e.g. the
+// server and the generator, can share one log.
+type Log struct {
+	mu   sync.Mutex // Serializes appends within the process, the file lock across processes
+	path string
+	key  []byte
+}
+
+// LoadKey reads an audit key from a file, ignoring surrounding whitespace
+func LoadKey(filePath string) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit key file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return nil, errors.New("audit key file is empty")
+	}
+	return []byte(key), nil
+}
+
+// Open opens the audit log at path, creating it if needed, and verifies the
+// existing chain with the key
+func Open(path string, key []byte) (*Log, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	if _, _, err := verifyFile(path, key, nil); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return &Log{path: path, key: key}, nil
+}
+
+// Path returns the audit log file path
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append adds an event to the log. Seq, Time, PrevHash and Hash are filled
+// in from the last event in the file, which must carry a valid HMAC.
+func (l *Log) Append(e Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer unlockFile(f)
+
+	last, err := l.lastEvent(f)
+	if err != nil {
+		return err
+	}
+	e.Seq = 1
+	e.PrevHash = ""
+	if last != nil {
+		e.Seq = last.Seq + 1
+		e.PrevHash = last.Hash
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	hash, err := e.computeHash(l.key)
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return nil
+}
+
+// Head returns the last event of the log, the zero Head when it is empty
+func (l *Log) Head() (Head, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Head{}, nil
+	}
+	if err != nil {
+		return Head{}, err
+	}
+	defer f.Close()
+
+	last, err := l.lastEvent(f)
+	if err != nil || last == nil {
+		return Head{}, err
+	}
+	return Head{Seq: last.Seq, Hash: last.Hash}, nil
+}
+
+// lastEvent reads the last line of the file and checks its HMAC
+func (l *Log) lastEvent(f *os.File) (*Event, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read backwards until the start of the last line
+	const chunk = 4096
+	var tail []byte
+	for end := info.Size(); end > 0; {
+		start := end - chunk
+		if start < 0 {
+			start = 0
+		}
+		buf := make([]byte, end-start)
+		if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		tail = append(buf, tail...)
+		end = start
+		if i := bytes.LastIndexByte(bytes.TrimRight(tail, "\n"), '\n'); i >= 0 {
+			tail = tail[i+1:]
+			break
+		}
+	}
+	tail = bytes.TrimSpace(tail)
+	if len(tail) == 0 {
+		return nil, nil
+	}
+
+	var e Event
+	if err := json.Unmarshal(tail, &e); err != nil {
+		return nil, fmt.Errorf("%w: last line is not a valid event: %v", ErrChainBroken, err)
+	}
+	hash, err := e.computeHash(l.key)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(hash), []byte(e.Hash)) {
+		return nil, fmt.Errorf("%w: last event %d has been modified", ErrChainBroken, e.Seq)
+	}
+	return &e, nil
+}
+
+// Verify checks the hash chain of the audit log at path and returns its
+// head and the number of events it contains
+func Verify(path string, key []byte) (Head, int, error) {
+	last, count, err := verifyFile(path, key, nil)
+	if last == nil {
+		return Head{}, count, err
+	}
+	return Head{Seq: last.Seq, Hash: last.Hash}, count, err
+}
+
+// CheckHead verifies the log like Verify and checks that it still holds the
+// event of a head recorded earlier, which fails when the log has been cut
+// off or rewritten since
+func CheckHead(path string, key []byte, head Head) (Head, int, error) {
+	found := false
+	last, count, err := verifyFile(path, key, func(e *Event) {
+		if e.Seq == head.Seq && e.Hash == head.Hash {
+			found = true
+		}
+	})
+	current := Head{}
+	if last != nil {
+		current = Head{Seq: last.Seq, Hash: last.Hash}
+	}
+	if err == nil && !found && head.Seq > 0 {
+		err = fmt.Errorf("%w: event %s recorded earlier is missing", ErrChainBroken, head)
+	}
+	return current, count, err
+}
+
+// verifyFile walks the chain, calling visit for every verified event, and
+// returns its last event
+func verifyFile(path string, key []byte, visit func(*Event)) (*Event, int, error) {
+	if len(key) == 0 {
+		return nil, 0, ErrNoKey
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var last *Event
+	count := 0
+	prevHash := ""
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		count++
+
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return last, count, fmt.Errorf("%w: line %d is not a valid event: %v", ErrChainBroken, count, err)
+		}
+		if e.Seq != uint64(count) {
+			return last, count, fmt.Errorf("%w: line %d has sequence %d", ErrChainBroken, count, e.Seq)
+		}
+		if e.PrevHash != prevHash {
+			return last, count, fmt.Errorf("%w: line %d does not follow the previous event", ErrChainBroken, count)
+		}
+		hash, err := e.computeHash(key)
+		if err != nil {
+			return last, count, err
+		}
+		if !hmac.Equal([]byte(hash), []byte(e.Hash)) {
+			return last, count, fmt.Errorf("%w: line %d has been modified", ErrChainBroken, count)
+		}
+
+		prevHash = e.Hash
+		last = &e
+		if visit != nil {
+			visit(last)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return last, count, err
+	}
+
+	return last, count, nil
+}
+
+// computeHash returns the HMAC-SHA256 of the event with the Hash field cleared
+func (e Event) computeHash(key []byte) (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
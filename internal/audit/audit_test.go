@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+var testKey = []byte("test audit key")
+
+// writeEvents appends n events to a new log and returns its path
+func writeEvents(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	l, err := Open(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := l.Append(Event{Action: ActionGenerate, Actor: "test", Serial: fmt.Sprintf("serial-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	path := writeEvents(t, 3)
+
+	head, count, err := Verify(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || head.Seq != 3 {
+		t.Errorf("verified %d events with head %s, want 3", count, head)
+	}
+
+	if _, _, err := Verify(path, []byte("other key")); !errors.Is(err, ErrChainBroken) {
+		t.Errorf("verify with another key: %v, want ErrChainBroken", err)
+	}
+}
+
+func TestVerifyModified(t *testing.T) {
+	path := writeEvents(t, 3)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, bytes.Replace(data, []byte("serial-1"), []byte("serial-X"), 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Verify(path, testKey); !errors.Is(err, ErrChainBroken) {
+		t.Errorf("verify of a modified log: %v, want ErrChainBroken", err)
+	}
+	if _, err := Open(path, testKey); !errors.Is(err, ErrChainBroken) {
+		t.Errorf("open of a modified log: %v, want ErrChainBroken", err)
+	}
+}
+
+func TestCheckHeadTruncated(t *testing.T) {
+	path := writeEvents(t, 3)
+	head, _, err := Verify(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := CheckHead(path, testKey, head); err != nil {
+		t.Fatalf("check of the current head: %v", err)
+	}
+
+	// Dropping the last line leaves a valid chain, only the head reveals it
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if err := os.WriteFile(path, bytes.Join(lines[:2], nil), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Verify(path, testKey); err != nil {
+		t.Fatalf("verify of the truncated log: %v", err)
+	}
+	if _, _, err := CheckHead(path, testKey, head); !errors.Is(err, ErrChainBroken) {
+		t.Errorf("check of a truncated log: %v, want ErrChainBroken", err)
+	}
+}
+
+// Two logs on the same file, like the server and the generator, continue
+// one chain instead of forking it
+func TestAppendShared(t *testing.T) {
+	path := writeEvents(t, 1)
+	a, err := Open(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Open(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l := a
+			if i%2 == 1 {
+				l = b
+			}
+			if err := l.Append(Event{Action: ActionRenew, Actor: "test"}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	head, count, err := Verify(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != n+1 || head.Seq != n+1 {
+		t.Errorf("verified %d events with head %s, want %d", count, head, n+1)
+	}
+	if h, err := a.Head(); err != nil || h != head {
+		t.Errorf("head %s, %v, want %s", h, err, head)
+	}
+}
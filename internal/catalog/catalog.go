@@ -0,0 +1,161 @@
+// Package catalog holds the product catalog: the editions of each
+// application and the features, limits and duration they grant.
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/chenwes/licensemodule/internal/license"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnknownApp     = errors.New("application is not in the catalog")
+	ErrUnknownEdition = errors.New("edition is not in the catalog")
+)
+
+// Catalog lists the editions of each application. Version must be raised
+// whenever the catalog changes, it is recorded with every license issued
+// from it.
+type Catalog struct {
+	Version int            `yaml:"version"`
+	Apps    map[string]App `yaml:"apps"` // By application ID
+}
+
+// App holds the editions of one application
+type App struct {
+	Editions map[string]Edition `yaml:"editions"` // By edition name, e.g. community, pro
+}
+
+// Edition is what a license of the edition grants
+type Edition struct {
+	Features     []string `yaml:"features"`
+	Days         int      `yaml:"days"` // Default validity, 0 uses the issuer's default
+	MaxCores     int      `yaml:"max_cores"`
+	MaxUsers     int      `yaml:"max_users"`
+	MaxInstances int      `yaml:"max_instances"`
+}
+
+// Entitlements are the features, validity and limits of a license
+type Entitlements struct {
+	Features []string
+	Days     int
+	Limits   license.Limits
+}
+
+// Load reads and validates a catalog file
+func Load(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	var c Catalog
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate checks the catalog for errors
+func (c *Catalog) Validate() error {
+	var errs []error
+	if c.Version <= 0 {
+		errs = append(errs, errors.New("catalog: version must be positive"))
+	}
+	for appID, app := range c.Apps {
+		if len(app.Editions) == 0 {
+			errs = append(errs, fmt.Errorf("catalog: %s has no editions", appID))
+		}
+		for name, e := range app.Editions {
+			if e.Days < 0 {
+				errs = append(errs, fmt.Errorf("catalog: %s/%s: days cannot be negative", appID, name))
+			}
+			if err := e.Limits().Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("catalog: %s/%s: %w", appID, name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Edition returns an edition of an application
+func (c *Catalog) Edition(appID, name string) (*Edition, error) {
+	app, ok := c.Apps[appID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownApp, appID)
+	}
+	e, ok := app.Editions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no edition %q, available: %v", ErrUnknownEdition, appID, name, c.Editions(appID))
+	}
+	return &e, nil
+}
+
+// Editions returns the sorted edition names of an application
+func (c *Catalog) Editions(appID string) []string {
+	var names []string
+	for name := range c.Apps[appID].Editions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Expand returns the entitlements of an edition. Requested features are
+// added to those of the edition, and a requested duration or limit
+// replaces the edition's.
+func (c *Catalog) Expand(appID, edition string, requested Entitlements) (Entitlements, error) {
+	e, err := c.Edition(appID, edition)
+	if err != nil {
+		return Entitlements{}, err
+	}
+
+	result := Entitlements{
+		Features: mergeFeatures(e.Features, requested.Features),
+		Days:     e.Days,
+		Limits:   e.Limits(),
+	}
+	if requested.Days > 0 {
+		result.Days = requested.Days
+	}
+	if requested.Limits.MaxCores > 0 {
+		result.Limits.MaxCores = requested.Limits.MaxCores
+	}
+	if requested.Limits.MaxUsers > 0 {
+		result.Limits.MaxUsers = requested.Limits.MaxUsers
+	}
+	if requested.Limits.MaxInstances > 0 {
+		result.Limits.MaxInstances = requested.Limits.MaxInstances
+	}
+	return result, nil
+}
+
+// Limits returns the limits of the edition
+func (e Edition) Limits() license.Limits {
+	return license.Limits{MaxCores: e.MaxCores, MaxUsers: e.MaxUsers, MaxInstances: e.MaxInstances}
+}
+
+// mergeFeatures appends the extra features that are not already present
+func mergeFeatures(base, extra []string) []string {
+	features := append([]string(nil), base...)
+	for _, f := range extra {
+		found := false
+		for _, b := range features {
+			if b == f {
+				found = true
+				break
+			}
+		}
+		if !found {
+			features = append(features, f)
+		}
+	}
+	return features
+}
@@ -0,0 +1,111 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Client certificate modes
+const (
+	ClientAuthNone     = "none"     // Do not request client certificates
+	ClientAuthOptional = "optional" // Verify client certificates when presented
+	ClientAuthRequire  = "require"  // Require a valid client certificate
+)
+
+// Reloader serves a certificate and client CA pool that can be reloaded from
+// disk while the server is running
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+
+	state atomic.Pointer[state]
+}
+
+type state struct {
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewReloader loads the certificate, key and optional client CA bundle
+func NewReloader(certFile, keyFile, clientCAFile, clientAuth string) (*Reloader, error) {
+	r := &Reloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+
+	switch clientAuth {
+	case "", ClientAuthNone:
+		r.clientAuth = tls.NoClientCert
+	case ClientAuthOptional:
+		r.clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		r.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode %q", clientAuth)
+	}
+
+	if r.clientAuth != tls.NoClientCert && clientCAFile == "" {
+		return nil, errors.New("client CA file is required for client certificate authentication")
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again. The previous certificates stay in use if
+// loading fails.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	next := &state{cert: &cert}
+	if r.clientCAFile != "" {
+		data, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return errors.New("no certificates found in client CA file")
+		}
+		next.clientCAs = pool
+	}
+
+	r.state.Store(next)
+	return nil
+}
+
+// nextProtos are negotiated with ALPN. gRPC clients require h2, the HTTP
+// server falls back to HTTP/1.1.
+var nextProtos = []string{"h2", "http/1.1"}
+
+// TLSConfig returns a server TLS configuration backed by the reloader
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			// The returned config replaces the outer one for the handshake,
+			// so it has to carry NextProtos as well
+			s := r.state.Load()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   nextProtos,
+				Certificates: []tls.Certificate{*s.cert},
+				ClientAuth:   r.clientAuth,
+				ClientCAs:    s.clientCAs,
+			}, nil
+		},
+	}
+}
@@ -0,0 +1,297 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA signs certificates for the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for a server or client
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// clientConfig returns a client configuration trusting ca, presenting the
+// certificate when certPEM is not nil, even if the server asks for another CA
+func (ca *testCA) clientConfig(t *testing.T, certPEM, keyPEM []byte) *tls.Config {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.pem)
+	cfg := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	if certPEM != nil {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &cert, nil
+		}
+	}
+	return cfg
+}
+
+// testFiles are the files a reloader is created from
+type testFiles struct {
+	cert, key, clientCA string
+}
+
+func writeFiles(t *testing.T, dir string, certPEM, keyPEM, clientCAPEM []byte) testFiles {
+	t.Helper()
+	f := testFiles{
+		cert:     filepath.Join(dir, "server.crt"),
+		key:      filepath.Join(dir, "server.key"),
+		clientCA: filepath.Join(dir, "client-ca.crt"),
+	}
+	for path, data := range map[string][]byte{f.cert: certPEM, f.key: keyPEM, f.clientCA: clientCAPEM} {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+// handshake connects a client to a TLS listener using the server
+// configuration and returns the server certificate the client saw and the
+// handshake error of the server
+func handshake(t *testing.T, serverCfg, clientCfg *tls.Config) (*x509.Certificate, error) {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		serverErr <- conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, clientErr := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+	var peer *x509.Certificate
+	if clientErr == nil {
+		peer = conn.ConnectionState().PeerCertificates[0]
+		// With TLS 1.3 the client finishes before the server checked its
+		// certificate, reading surfaces a rejection
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	if err := <-serverErr; err != nil {
+		return peer, err
+	}
+	if clientErr != nil {
+		return nil, clientErr
+	}
+	return peer, nil
+}
+
+func TestReloaderMutualTLS(t *testing.T) {
+	ca := newTestCA(t, "test CA")
+	serverCert, serverKey := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	other := newTestCA(t, "other CA")
+	otherCert, otherKey := other.issue(t, "intruder", x509.ExtKeyUsageClientAuth)
+
+	f := writeFiles(t, t.TempDir(), serverCert, serverKey, ca.pem)
+	r, err := NewReloader(f.cert, f.key, f.clientCA, ClientAuthRequire)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := handshake(t, r.TLSConfig(), ca.clientConfig(t, clientCert, clientKey)); err != nil {
+		t.Errorf("client certificate of the CA rejected: %v", err)
+	}
+	if _, err := handshake(t, r.TLSConfig(), ca.clientConfig(t, nil, nil)); err == nil {
+		t.Error("connection without client certificate accepted")
+	}
+	if _, err := handshake(t, r.TLSConfig(), ca.clientConfig(t, otherCert, otherKey)); err == nil {
+		t.Error("client certificate of another CA accepted")
+	}
+}
+
+// gRPC clients only accept connections that negotiated h2
+func TestReloaderNextProtos(t *testing.T) {
+	ca := newTestCA(t, "test CA")
+	serverCert, serverKey := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	f := writeFiles(t, t.TempDir(), serverCert, serverKey, ca.pem)
+	r, err := NewReloader(f.cert, f.key, "", ClientAuthNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", r.TLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	cfg := ca.clientConfig(t, nil, nil)
+	cfg.NextProtos = []string{"h2"}
+	conn, err := tls.Dial("tcp", ln.Addr().String(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != "h2" {
+		t.Errorf("negotiated protocol %q, want h2", proto)
+	}
+}
+
+func TestReloaderOptionalClientAuth(t *testing.T) {
+	ca := newTestCA(t, "test CA")
+	serverCert, serverKey := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	other := newTestCA(t, "other CA")
+	otherCert, otherKey := other.issue(t, "intruder", x509.ExtKeyUsageClientAuth)
+
+	f := writeFiles(t, t.TempDir(), serverCert, serverKey, ca.pem)
+	r, err := NewReloader(f.cert, f.key, f.clientCA, ClientAuthOptional)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := handshake(t, r.TLSConfig(), ca.clientConfig(t, nil, nil)); err != nil {
+		t.Errorf("connection without client certificate rejected: %v", err)
+	}
+	if _, err := handshake(t, r.TLSConfig(), ca.clientConfig(t, otherCert, otherKey)); err == nil {
+		t.Error("client certificate of another CA accepted")
+	}
+}
+
+func TestReloaderReload(t *testing.T) {
+	ca := newTestCA(t, "test CA")
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	firstCert, firstKey := ca.issue(t, "server-1", x509.ExtKeyUsageServerAuth)
+
+	dir := t.TempDir()
+	f := writeFiles(t, dir, firstCert, firstKey, ca.pem)
+	r, err := NewReloader(f.cert, f.key, f.clientCA, ClientAuthRequire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := r.TLSConfig()
+
+	peer, err := handshake(t, cfg, ca.clientConfig(t, clientCert, clientKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer.Subject.CommonName != "server-1" {
+		t.Fatalf("server certificate %q, want server-1", peer.Subject.CommonName)
+	}
+
+	// Replace the server certificate and trust clients of a new CA instead
+	newCA := newTestCA(t, "new CA")
+	secondCert, secondKey := ca.issue(t, "server-2", x509.ExtKeyUsageServerAuth)
+	newClientCert, newClientKey := newCA.issue(t, "new client", x509.ExtKeyUsageClientAuth)
+	writeFiles(t, dir, secondCert, secondKey, newCA.pem)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	peer, err = handshake(t, cfg, ca.clientConfig(t, newClientCert, newClientKey))
+	if err != nil {
+		t.Fatalf("client of the new CA rejected after reload: %v", err)
+	}
+	if peer.Subject.CommonName != "server-2" {
+		t.Errorf("server certificate %q after reload, want server-2", peer.Subject.CommonName)
+	}
+	if _, err := handshake(t, cfg, ca.clientConfig(t, clientCert, clientKey)); err == nil {
+		t.Error("client of the replaced CA accepted after reload")
+	}
+
+	// A broken file keeps the previous certificates in use
+	if err := os.WriteFile(f.cert, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("reload of an invalid certificate succeeded")
+	}
+	peer, err = handshake(t, cfg, ca.clientConfig(t, newClientCert, newClientKey))
+	if err != nil || peer.Subject.CommonName != "server-2" {
+		t.Errorf("previous certificate not kept after failed reload: %v", err)
+	}
+}
@@ -0,0 +1,649 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/audit"
+	"github.com/chenwes/licensemodule/internal/certs"
+	"github.com/chenwes/licensemodule/internal/floating"
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/logging"
+	"github.com/chenwes/licensemodule/internal/store"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of environment variables that override the config file
+const EnvPrefix = "CF_LICENSE_"
+
+// Key providers
+const (
+	KeyProviderBuiltin = "builtin" // Use the key compiled into the binary
+	KeyProviderEnv     = "env"     // Read the key from an environment variable
+	KeyProviderFile    = "file"    // Read the key from a file
+)
+
+// Config holds the server configuration
+type Config struct {
+	Listen    string          `yaml:"listen"`
+	GRPC      GRPCConfig      `yaml:"grpc"`
+	Server    ServerConfig    `yaml:"server"`
+	TLS       TLSConfig       `yaml:"tls"`
+	Key       KeyConfig       `yaml:"key"`
+	Store     StoreConfig     `yaml:"store"`
+	Auth      AuthConfig      `yaml:"auth"`
+	License   LicenseConfig   `yaml:"license"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Floating  FloatingConfig  `yaml:"floating"`
+	Audit     AuditConfig     `yaml:"audit"`
+	Log       LogConfig       `yaml:"log"`
+}
+
+// GRPCConfig holds the gRPC server settings. The gRPC server shares the TLS
+// settings of the HTTP server.
+type GRPCConfig struct {
+	Listen string `yaml:"listen"` // Empty disables the gRPC server
+}
+
+// ServerConfig holds the HTTP server limits
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"` // Time allowed to drain requests
+	MaxBodyBytes      int64         `yaml:"max_body_bytes"`   // Limit for request bodies
+}
+
+// TLSConfig holds the server certificate settings
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"` // CA bundle for client certificates
+	ClientAuth   string `yaml:"client_auth"`    // none, optional or require
+}
+
+// KeyConfig selects where the signing key comes from
+type KeyConfig struct {
+	Provider string `yaml:"provider"`
+	Env      string `yaml:"env"`  // Variable name for the env provider
+	File     string `yaml:"file"` // Key file for the file provider
+
+	// PreviousFiles hold keys used before a rotation, they still verify the
+	// licenses they signed but sign no new ones
+	PreviousFiles []string `yaml:"previous_files"`
+
+	// EncryptionFile holds the master key of encrypted licenses, empty
+	// disables encryption
+	EncryptionFile string `yaml:"encryption_file"`
+}
+
+// StoreConfig holds the server-side state settings
+type StoreConfig struct {
+	Path string `yaml:"path"`
+}
+
+// AuthConfig holds the API key settings for issuing endpoints
+type AuthConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	APIKeys []APIKey `yaml:"api_keys"`
+}
+
+// APIKey is a named API key
+type APIKey struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+// LicenseConfig holds the license issuing policy
+type LicenseConfig struct {
+	DefaultDays   int            `yaml:"default_days"`
+	MaxDays       int            `yaml:"max_days"` // 0 means unlimited
+	Filename      string         `yaml:"filename"`
+	AllowedAppIDs []string       `yaml:"allowed_app_ids"`  // Empty means any app
+	MaxDaysPerApp map[string]int `yaml:"max_days_per_app"` // Overrides max_days for an app
+	Catalog       string         `yaml:"catalog"`          // Product catalog file, empty disables editions
+
+	// ActivationDays is the validity of licenses issued for activation codes.
+	// Clients activate again before it ends, so a deactivated machine stops
+	// working within this time. 0 issues them for the full term of the code.
+	ActivationDays int `yaml:"activation_days"`
+
+	// RejectSuperseded fails verification of licenses that have been renewed
+	RejectSuperseded bool `yaml:"reject_superseded"`
+
+	// Encrypt issues every license file encrypted, requires key.encryption_file
+	Encrypt bool `yaml:"encrypt"`
+}
+
+// RateLimitConfig holds the abuse protection settings of issuing endpoints
+type RateLimitConfig struct {
+	PerIP      RateConfig       `yaml:"per_ip"`
+	PerClient  RateConfig       `yaml:"per_client"` // Per API key or client certificate
+	MachineCap MachineCapConfig `yaml:"machine_cap"`
+}
+
+// RateConfig is a token bucket, PerMinute 0 disables it
+type RateConfig struct {
+	PerMinute int `yaml:"per_minute"`
+	Burst     int `yaml:"burst"`
+}
+
+// MachineCapConfig limits how many licenses one machine ID can receive
+// within a period, MaxLicenses 0 disables it
+type MachineCapConfig struct {
+	MaxLicenses int           `yaml:"max_licenses"`
+	Period      time.Duration `yaml:"period"`
+}
+
+// MetricsConfig holds the Prometheus metrics settings
+type MetricsConfig struct {
+	Enabled            bool `yaml:"enabled"`
+	ExpiringWithinDays int  `yaml:"expiring_within_days"` // Window of the expiring licenses gauge
+}
+
+// FloatingConfig holds the floating license server settings
+type FloatingConfig struct {
+	Licenses  []string      `yaml:"licenses"`   // Floating license files to serve, empty disables the lease endpoints
+	LeaseTTL  time.Duration `yaml:"lease_ttl"`  // Lifetime of a lease between heartbeats
+	MaxBorrow time.Duration `yaml:"max_borrow"` // Longest time a lease can be borrowed for offline use
+}
+
+// AuditConfig holds the audit log settings
+type AuditConfig struct {
+	Path    string `yaml:"path"`     // Empty means audit.log in the store directory
+	KeyFile string `yaml:"key_file"` // Key of the hash chain, empty means audit.DefaultKey
+}
+
+// LogConfig holds the logging settings
+type LogConfig struct {
+	Format string `yaml:"format"` // text or json
+	Level  string `yaml:"level"`  // debug, info, warn or error
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	return &Config{
+		Listen: ":8080",
+		Server: ServerConfig{
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			MaxBodyBytes:      1 << 20,
+		},
+		TLS: TLSConfig{
+			ClientAuth: certs.ClientAuthNone,
+		},
+		Key: KeyConfig{
+			Provider: KeyProviderBuiltin,
+			Env:      EnvPrefix + "SECRET_KEY",
+		},
+		Store: StoreConfig{
+			Path: store.DefaultDir,
+		},
+		License: LicenseConfig{
+			DefaultDays:    30,
+			ActivationDays: 7,
+			Filename:       "license-{app}-{serial}.dat",
+		},
+		RateLimit: RateLimitConfig{
+			PerIP:     RateConfig{PerMinute: 60, Burst: 10},
+			PerClient: RateConfig{PerMinute: 600, Burst: 50},
+			MachineCap: MachineCapConfig{
+				Period: 24 * time.Hour,
+			},
+		},
+		Metrics: MetricsConfig{
+			Enabled:            true,
+			ExpiringWithinDays: 30,
+		},
+		Floating: FloatingConfig{
+			LeaseTTL:  floating.DefaultLeaseTTL,
+			MaxBorrow: floating.DefaultMaxBorrow,
+		},
+		Log: LogConfig{
+			Format: logging.FormatText,
+			Level:  "info",
+		},
+	}
+}
+
+// Load reads the config file (if any) on top of the defaults and applies
+// environment variable overrides
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		// Unknown keys are errors, a typo such as cert_fle would otherwise
+		// silently start the server without TLS
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// applyEnv overrides settings from CF_LICENSE_* environment variables
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	str := func(name string, dst *string) {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			*dst = v
+		}
+	}
+	list := func(name string, dst *[]string) {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			*dst = splitList(v)
+		}
+	}
+	duration := func(name string, dst *time.Duration) error {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s%s: %w", EnvPrefix, name, err)
+			}
+			*dst = d
+		}
+		return nil
+	}
+	boolean := func(name string, dst *bool) error {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s%s: %w", EnvPrefix, name, err)
+			}
+			*dst = b
+		}
+		return nil
+	}
+	integer := func(name string, dst *int) error {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s%s: %w", EnvPrefix, name, err)
+			}
+			*dst = n
+		}
+		return nil
+	}
+
+	str("LISTEN", &c.Listen)
+	str("GRPC_LISTEN", &c.GRPC.Listen)
+	str("TLS_CERT_FILE", &c.TLS.CertFile)
+	str("TLS_KEY_FILE", &c.TLS.KeyFile)
+	str("TLS_CLIENT_CA_FILE", &c.TLS.ClientCAFile)
+	str("TLS_CLIENT_AUTH", &c.TLS.ClientAuth)
+	str("KEY_PROVIDER", &c.Key.Provider)
+	str("KEY_ENV", &c.Key.Env)
+	str("KEY_FILE", &c.Key.File)
+	list("KEY_PREVIOUS_FILES", &c.Key.PreviousFiles)
+	str("KEY_ENCRYPTION_FILE", &c.Key.EncryptionFile)
+	str("STORE_PATH", &c.Store.Path)
+	str("LICENSE_FILENAME", &c.License.Filename)
+	str("LICENSE_CATALOG", &c.License.Catalog)
+	list("ALLOWED_APP_IDS", &c.License.AllowedAppIDs)
+	list("FLOATING_LICENSES", &c.Floating.Licenses)
+	str("AUDIT_PATH", &c.Audit.Path)
+	str("AUDIT_KEY_FILE", &c.Audit.KeyFile)
+	str("LOG_FORMAT", &c.Log.Format)
+	str("LOG_LEVEL", &c.Log.Level)
+
+	for name, dst := range map[string]*time.Duration{
+		"SERVER_READ_HEADER_TIMEOUT": &c.Server.ReadHeaderTimeout,
+		"SERVER_READ_TIMEOUT":        &c.Server.ReadTimeout,
+		"SERVER_WRITE_TIMEOUT":       &c.Server.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":        &c.Server.IdleTimeout,
+		"SERVER_SHUTDOWN_TIMEOUT":    &c.Server.ShutdownTimeout,
+	} {
+		if err := duration(name, dst); err != nil {
+			return err
+		}
+	}
+	if v, ok := lookup(EnvPrefix + "SERVER_MAX_BODY_BYTES"); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %sSERVER_MAX_BODY_BYTES: %w", EnvPrefix, err)
+		}
+		c.Server.MaxBodyBytes = n
+	}
+
+	if err := integer("DEFAULT_DAYS", &c.License.DefaultDays); err != nil {
+		return err
+	}
+	if err := integer("MAX_DAYS", &c.License.MaxDays); err != nil {
+		return err
+	}
+	if err := integer("ACTIVATION_DAYS", &c.License.ActivationDays); err != nil {
+		return err
+	}
+	if err := integer("METRICS_EXPIRING_WITHIN_DAYS", &c.Metrics.ExpiringWithinDays); err != nil {
+		return err
+	}
+	for name, dst := range map[string]*int{
+		"RATE_LIMIT_PER_IP_PER_MINUTE":        &c.RateLimit.PerIP.PerMinute,
+		"RATE_LIMIT_PER_IP_BURST":             &c.RateLimit.PerIP.Burst,
+		"RATE_LIMIT_PER_CLIENT_PER_MINUTE":    &c.RateLimit.PerClient.PerMinute,
+		"RATE_LIMIT_PER_CLIENT_BURST":         &c.RateLimit.PerClient.Burst,
+		"RATE_LIMIT_MACHINE_CAP_MAX_LICENSES": &c.RateLimit.MachineCap.MaxLicenses,
+	} {
+		if err := integer(name, dst); err != nil {
+			return err
+		}
+	}
+	if err := duration("RATE_LIMIT_MACHINE_CAP_PERIOD", &c.RateLimit.MachineCap.Period); err != nil {
+		return err
+	}
+	if err := duration("FLOATING_LEASE_TTL", &c.Floating.LeaseTTL); err != nil {
+		return err
+	}
+	if err := duration("FLOATING_MAX_BORROW", &c.Floating.MaxBorrow); err != nil {
+		return err
+	}
+
+	// Per-app maximum durations are given as "app:days,app:days"
+	if v, ok := lookup(EnvPrefix + "MAX_DAYS_PER_APP"); ok {
+		c.License.MaxDaysPerApp = make(map[string]int)
+		for _, item := range splitList(v) {
+			app, days, found := strings.Cut(item, ":")
+			n, err := strconv.Atoi(days)
+			if !found || err != nil {
+				return fmt.Errorf("invalid %sMAX_DAYS_PER_APP entry %q, expected app:days", EnvPrefix, item)
+			}
+			c.License.MaxDaysPerApp[app] = n
+		}
+	}
+
+	if err := boolean("AUTH_ENABLED", &c.Auth.Enabled); err != nil {
+		return err
+	}
+	if err := boolean("LICENSE_REJECT_SUPERSEDED", &c.License.RejectSuperseded); err != nil {
+		return err
+	}
+	if err := boolean("LICENSE_ENCRYPT", &c.License.Encrypt); err != nil {
+		return err
+	}
+	if err := boolean("METRICS_ENABLED", &c.Metrics.Enabled); err != nil {
+		return err
+	}
+
+	// API keys are given as "name:key,name:key"
+	if v, ok := lookup(EnvPrefix + "AUTH_API_KEYS"); ok {
+		c.Auth.APIKeys = nil
+		for _, item := range splitList(v) {
+			name, key, found := strings.Cut(item, ":")
+			if !found {
+				return fmt.Errorf("invalid %sAUTH_API_KEYS entry %q, expected name:key", EnvPrefix, item)
+			}
+			c.Auth.APIKeys = append(c.Auth.APIKeys, APIKey{Name: name, Key: key})
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the configuration for errors
+func (c *Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		errs = append(errs, fmt.Errorf("listen: %w", err))
+	}
+	if c.GRPC.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.GRPC.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("grpc.listen: %w", err))
+		}
+	}
+
+	timeouts := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"read_timeout", c.Server.ReadTimeout},
+		{"write_timeout", c.Server.WriteTimeout},
+		{"idle_timeout", c.Server.IdleTimeout},
+		{"shutdown_timeout", c.Server.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d <= 0 {
+			errs = append(errs, fmt.Errorf("server: %s must be positive", t.name))
+		}
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("server: max_body_bytes must be positive"))
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls: cert_file and key_file must be set together"))
+	}
+	switch c.TLS.ClientAuth {
+	case "", certs.ClientAuthNone:
+	case certs.ClientAuthOptional, certs.ClientAuthRequire:
+		if c.TLS.CertFile == "" {
+			errs = append(errs, errors.New("tls: client certificate authentication requires cert_file and key_file"))
+		}
+		if c.TLS.ClientCAFile == "" {
+			errs = append(errs, errors.New("tls: client_ca_file is required for client certificate authentication"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tls: unknown client_auth %q", c.TLS.ClientAuth))
+	}
+
+	switch c.Key.Provider {
+	case KeyProviderBuiltin:
+	case KeyProviderEnv:
+		if c.Key.Env == "" {
+			errs = append(errs, errors.New("key: env is required for the env provider"))
+		}
+	case KeyProviderFile:
+		if c.Key.File == "" {
+			errs = append(errs, errors.New("key: file is required for the file provider"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("key: unknown provider %q", c.Key.Provider))
+	}
+	if c.License.Encrypt && c.Key.EncryptionFile == "" {
+		errs = append(errs, errors.New("license: encrypt requires key.encryption_file"))
+	}
+
+	if c.Store.Path == "" {
+		errs = append(errs, errors.New("store: path is required"))
+	}
+
+	if c.Auth.Enabled && len(c.Auth.APIKeys) == 0 {
+		errs = append(errs, errors.New("auth: at least one API key is required when auth is enabled"))
+	}
+	seen := make(map[string]bool)
+	for i, k := range c.Auth.APIKeys {
+		if k.Name == "" || k.Key == "" {
+			errs = append(errs, fmt.Errorf("auth: api_keys[%d] requires name and key", i))
+		}
+		if seen[k.Key] {
+			errs = append(errs, fmt.Errorf("auth: api_keys[%d] duplicates another key", i))
+		}
+		seen[k.Key] = true
+	}
+
+	if c.License.DefaultDays <= 0 {
+		errs = append(errs, errors.New("license: default_days must be positive"))
+	}
+	if c.License.MaxDays < 0 {
+		errs = append(errs, errors.New("license: max_days cannot be negative"))
+	}
+	if c.License.MaxDays > 0 && c.License.DefaultDays > c.License.MaxDays {
+		errs = append(errs, errors.New("license: default_days exceeds max_days"))
+	}
+	if c.License.ActivationDays < 0 {
+		errs = append(errs, errors.New("license: activation_days cannot be negative"))
+	}
+
+	for app, days := range c.License.MaxDaysPerApp {
+		if days <= 0 {
+			errs = append(errs, fmt.Errorf("license: max_days_per_app[%s] must be positive", app))
+		}
+	}
+
+	rates := []struct {
+		name string
+		r    RateConfig
+	}{
+		{"per_ip", c.RateLimit.PerIP},
+		{"per_client", c.RateLimit.PerClient},
+	}
+	for _, r := range rates {
+		if r.r.PerMinute < 0 || r.r.Burst < 0 {
+			errs = append(errs, fmt.Errorf("rate_limit: %s cannot be negative", r.name))
+		}
+	}
+	if c.RateLimit.MachineCap.MaxLicenses < 0 {
+		errs = append(errs, errors.New("rate_limit: machine_cap.max_licenses cannot be negative"))
+	}
+	if c.RateLimit.MachineCap.MaxLicenses > 0 && c.RateLimit.MachineCap.Period <= 0 {
+		errs = append(errs, errors.New("rate_limit: machine_cap.period must be positive"))
+	}
+
+	if c.Metrics.Enabled && c.Metrics.ExpiringWithinDays <= 0 {
+		errs = append(errs, errors.New("metrics: expiring_within_days must be positive"))
+	}
+
+	if len(c.Floating.Licenses) > 0 {
+		if c.Floating.LeaseTTL <= 0 {
+			errs = append(errs, errors.New("floating: lease_ttl must be positive"))
+		}
+		if c.Floating.MaxBorrow <= 0 {
+			errs = append(errs, errors.New("floating: max_borrow must be positive"))
+		}
+	}
+
+	switch c.Log.Format {
+	case logging.FormatText, logging.FormatJSON:
+	default:
+		errs = append(errs, fmt.Errorf("log: unknown format %q", c.Log.Format))
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// SigningKey loads the license signing key from the configured provider.
+// It returns nil for the builtin provider.
+func (c *Config) SigningKey() ([]byte, error) {
+	switch c.Key.Provider {
+	case KeyProviderEnv:
+		v := os.Getenv(c.Key.Env)
+		if v == "" {
+			return nil, fmt.Errorf("signing key variable %s is empty", c.Key.Env)
+		}
+		return []byte(v), nil
+	case KeyProviderFile:
+		return readKeyFile(c.Key.File)
+	}
+	return nil, nil
+}
+
+// PreviousKeys loads the keys used before a rotation
+func (c *Config) PreviousKeys() ([][]byte, error) {
+	keys := make([][]byte, 0, len(c.Key.PreviousFiles))
+	for _, file := range c.Key.PreviousFiles {
+		key, err := readKeyFile(file)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// readKeyFile reads a signing key from a file, ignoring surrounding whitespace
+func readKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return nil, fmt.Errorf("signing key file %s is empty", path)
+	}
+	return []byte(key), nil
+}
+
+// EncryptionKey loads the master key of encrypted licenses, nil when no
+// key file is configured
+func (c *Config) EncryptionKey() ([]byte, error) {
+	if c.Key.EncryptionFile == "" {
+		return nil, nil
+	}
+	return license.LoadEncryptionKey(c.Key.EncryptionFile)
+}
+
+// AuditKey loads the key of the audit log hash chain, nil when no key file
+// is configured
+func (c *Config) AuditKey() ([]byte, error) {
+	if c.Audit.KeyFile == "" {
+		return nil, nil
+	}
+	return audit.LoadKey(c.Audit.KeyFile)
+}
+
+// AuditPath returns the audit log path, defaulting to the store directory
+func (c *Config) AuditPath() string {
+	if c.Audit.Path != "" {
+		return c.Audit.Path
+	}
+	return filepath.Join(c.Store.Path, audit.DefaultFile)
+}
+
+// Redacted returns the configuration as a map with secrets masked, suitable
+// for logging the effective settings
+func (c *Config) Redacted() map[string]any {
+	redacted := *c
+	redacted.Auth.APIKeys = make([]APIKey, len(c.Auth.APIKeys))
+	for i, k := range c.Auth.APIKeys {
+		redacted.Auth.APIKeys[i] = APIKey{Name: k.Name, Key: "******"}
+	}
+
+	// Round trip through YAML so the keys match the config file
+	m := make(map[string]any)
+	data, err := yaml.Marshal(&redacted)
+	if err == nil {
+		err = yaml.Unmarshal(data, &m)
+	}
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	return m
+}
+
+// splitList splits a comma separated list and drops empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "listen: \":9090\"\ntls:\n  cert_file: server.crt\n  key_file: server.key\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":9090" || cfg.TLS.CertFile != "server.crt" {
+		t.Errorf("loaded listen %q and cert_file %q", cfg.Listen, cfg.TLS.CertFile)
+	}
+	if cfg.License.DefaultDays != Default().License.DefaultDays {
+		t.Errorf("default_days %d, want the default", cfg.License.DefaultDays)
+	}
+
+	if _, err := Load(writeConfig(t, "")); err != nil {
+		t.Errorf("load of an empty file: %v", err)
+	}
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	for _, content := range []string{
+		"tls:\n  cert_fle: server.crt\n",
+		"auth:\n  enabled: true\n  tokns: [secret]\n",
+		"listn: \":9090\"\n",
+	} {
+		if _, err := Load(writeConfig(t, content)); err == nil {
+			t.Errorf("loaded %q without an error", content)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		EnvPrefix + "LISTEN":                        ":9443",
+		EnvPrefix + "AUTH_ENABLED":                  "true",
+		EnvPrefix + "AUTH_API_KEYS":                 "backend:secret, ops:other",
+		EnvPrefix + "MAX_DAYS_PER_APP":              "app:30,suite:365",
+		EnvPrefix + "RATE_LIMIT_MACHINE_CAP_PERIOD": "1h",
+		EnvPrefix + "KEY_PREVIOUS_FILES":            "old1.key,,old2.key",
+	}
+	cfg := Default()
+	err := cfg.applyEnv(func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Listen != ":9443" || !cfg.Auth.Enabled {
+		t.Errorf("listen %q, auth enabled %v", cfg.Listen, cfg.Auth.Enabled)
+	}
+	if len(cfg.Auth.APIKeys) != 2 || cfg.Auth.APIKeys[1] != (APIKey{Name: "ops", Key: "other"}) {
+		t.Errorf("API keys %v", cfg.Auth.APIKeys)
+	}
+	if cfg.License.MaxDaysPerApp["suite"] != 365 {
+		t.Errorf("max days per app %v", cfg.License.MaxDaysPerApp)
+	}
+	if cfg.RateLimit.MachineCap.Period != time.Hour {
+		t.Errorf("machine cap period %s", cfg.RateLimit.MachineCap.Period)
+	}
+	if len(cfg.Key.PreviousFiles) != 2 {
+		t.Errorf("previous key files %v", cfg.Key.PreviousFiles)
+	}
+
+	for name, value := range map[string]string{
+		"AUTH_ENABLED":     "maybe",
+		"DEFAULT_DAYS":     "ten",
+		"MAX_DAYS_PER_APP": "app",
+		"AUTH_API_KEYS":    "secret",
+	} {
+		err := Default().applyEnv(func(n string) (string, bool) {
+			return value, n == EnvPrefix+name
+		})
+		if err == nil {
+			t.Errorf("%s%s=%q applied without an error", EnvPrefix, name, value)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("default config: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"listen", func(c *Config) { c.Listen = "8080" }, "listen"},
+		{"tls pair", func(c *Config) { c.TLS.CertFile = "server.crt" }, "cert_file and key_file"},
+		{"client auth", func(c *Config) { c.TLS.ClientAuth = "always" }, "client_auth"},
+		{"key provider", func(c *Config) { c.Key.Provider = "vault" }, "provider"},
+		{"encrypt", func(c *Config) { c.License.Encrypt = true }, "encryption_file"},
+		{"auth", func(c *Config) { c.Auth.Enabled = true }, "API key"},
+		{"duplicate key", func(c *Config) {
+			c.Auth.APIKeys = []APIKey{{Name: "a", Key: "k"}, {Name: "b", Key: "k"}}
+		}, "duplicates"},
+		{"default days", func(c *Config) { c.License.MaxDays = 10 }, "exceeds max_days"},
+		{"machine cap", func(c *Config) {
+			c.RateLimit.MachineCap = MachineCapConfig{MaxLicenses: 1}
+		}, "machine_cap.period"},
+		{"log format", func(c *Config) { c.Log.Format = "xml" }, "format"},
+	}
+	for _, tt := range tests {
+		cfg := Default()
+		tt.modify(cfg)
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want an error mentioning %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.APIKeys = []APIKey{{Name: "backend", Key: "top-secret"}}
+
+	m := cfg.Redacted()
+	if _, ok := m["error"]; ok {
+		t.Fatal(m["error"])
+	}
+	auth, _ := m["auth"].(map[string]any)
+	keys, _ := auth["api_keys"].([]any)
+	if len(keys) != 1 {
+		t.Fatalf("redacted API keys %v", auth["api_keys"])
+	}
+	if key, _ := keys[0].(map[string]any); key["name"] != "backend" || key["key"] == "top-secret" {
+		t.Errorf("redacted API key %v", key)
+	}
+	if cfg.Auth.APIKeys[0].Key != "top-secret" {
+		t.Error("Redacted changed the config")
+	}
+}
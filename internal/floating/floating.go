@@ -0,0 +1,297 @@
+package floating
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/store"
+)
+
+// Defaults for the lease times
+const (
+	DefaultLeaseTTL  = 5 * time.Minute
+	DefaultMaxBorrow = 7 * 24 * time.Hour
+)
+
+var (
+	ErrNoLicense      = errors.New("no floating license for this application")
+	ErrNoSeats        = errors.New("all seats are in use")
+	ErrLeaseNotFound  = errors.New("lease not found")
+	ErrBorrowTooLong  = errors.New("borrow duration exceeds the maximum")
+	ErrAlreadyPresent = errors.New("a floating license for this application is already loaded")
+)
+
+// Manager hands out leases of the floating licenses loaded on this server.
+// Leases that are not renewed before they expire free their seat.
+type Manager struct {
+	mu       sync.Mutex
+	licenses map[string]*license.License // By application ID
+	leases   map[string]*license.Lease   // By lease ID
+
+	store     *store.Store // Persists leases across restarts, may be nil
+	leaseTTL  time.Duration
+	maxBorrow time.Duration
+}
+
+// PoolStatus describes the seats of one floating license
+type PoolStatus struct {
+	AppID      string           `json:"app_id"`
+	Serial     string           `json:"serial"`
+	Seats      int              `json:"seats"`
+	InUse      int              `json:"in_use"`
+	ExpiryDate time.Time        `json:"expiry_date"`
+	Leases     []*license.Lease `json:"leases"`
+}
+
+// New creates a manager and restores the leases kept in st
+func New(st *store.Store, leaseTTL, maxBorrow time.Duration) (*Manager, error) {
+	if leaseTTL <= 0 {
+		leaseTTL = DefaultLeaseTTL
+	}
+	if maxBorrow <= 0 {
+		maxBorrow = DefaultMaxBorrow
+	}
+
+	m := &Manager{
+		licenses:  make(map[string]*license.License),
+		leases:    make(map[string]*license.Lease),
+		store:     st,
+		leaseTTL:  leaseTTL,
+		maxBorrow: maxBorrow,
+	}
+
+	if st != nil {
+		leases, err := st.Leases()
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range leases {
+			m.leases[l.ID] = l
+		}
+	}
+	return m, nil
+}
+
+// LeaseTTL returns how long a lease is valid without a heartbeat
+func (m *Manager) LeaseTTL() time.Duration {
+	return m.leaseTTL
+}
+
+// AddLicense loads a floating license. The caller verifies the license
+// against this server first.
+func (m *Manager) AddLicense(lic *license.License) error {
+	if !lic.Floating() {
+		return fmt.Errorf("license %s is not a floating license", lic.Serial)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.licenses[lic.AppID]; ok {
+		return fmt.Errorf("%w: %s", ErrAlreadyPresent, lic.AppID)
+	}
+	m.licenses[lic.AppID] = lic
+	return nil
+}
+
+// Acquire checks out a seat for a client. A client that already holds a
+// lease for the application gets it back renewed, or unchanged when it is
+// borrowed, so the seat stays taken until the borrow ends.
+func (m *Manager) Acquire(appID, clientID, user string) (*license.Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	m.expire(now)
+
+	lic, ok := m.licenses[appID]
+	if !ok {
+		return nil, ErrNoLicense
+	}
+	if now.After(lic.ExpiryDate) {
+		return nil, license.ErrExpiredLicense
+	}
+
+	for _, l := range m.leases {
+		if l.AppID == appID && l.ClientID == clientID {
+			if l.Borrowed {
+				return clone(l), nil
+			}
+			return m.renew(l, now)
+		}
+	}
+	if m.inUse(appID) >= lic.Seats {
+		return nil, ErrNoSeats
+	}
+
+	id, err := license.NewLeaseID()
+	if err != nil {
+		return nil, err
+	}
+	lease := &license.Lease{
+		ID:       id,
+		Serial:   lic.Serial,
+		AppID:    appID,
+		Features: lic.Features,
+		ClientID: clientID,
+		User:     user,
+		IssuedAt: now,
+	}
+	m.leases[id] = lease
+	return m.renew(lease, now)
+}
+
+// Renew extends a lease by the lease time. Borrowed leases are returned
+// unchanged.
+func (m *Manager) Renew(leaseID, clientID string) (*license.Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	m.expire(now)
+
+	lease, err := m.lookup(leaseID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if lease.Borrowed {
+		return clone(lease), nil
+	}
+	return m.renew(lease, now)
+}
+
+// Borrow extends a lease for offline use for up to the maximum borrow time
+func (m *Manager) Borrow(leaseID, clientID string, d time.Duration) (*license.Lease, error) {
+	if d <= 0 || d > m.maxBorrow {
+		return nil, fmt.Errorf("%w of %s", ErrBorrowTooLong, m.maxBorrow)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	m.expire(now)
+
+	lease, err := m.lookup(leaseID, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A borrowed lease never outlives the floating license
+	expires := now.Add(d)
+	if lic, ok := m.licenses[lease.AppID]; ok && expires.After(lic.ExpiryDate) {
+		expires = lic.ExpiryDate
+	}
+
+	lease.Borrowed = true
+	lease.IssuedAt = now
+	lease.ExpiresAt = expires
+	if err := lease.Sign(); err != nil {
+		return nil, err
+	}
+	return clone(lease), m.save()
+}
+
+// Release frees the seat of a lease, including a borrowed lease returned early
+func (m *Manager) Release(leaseID, clientID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.lookup(leaseID, clientID); err != nil {
+		return err
+	}
+	delete(m.leases, leaseID)
+	return m.save()
+}
+
+// Status returns the seats of every floating license, sorted by application
+func (m *Manager) Status() []PoolStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire(time.Now().UTC())
+
+	var pools []PoolStatus
+	for appID, lic := range m.licenses {
+		pool := PoolStatus{
+			AppID:      appID,
+			Serial:     lic.Serial,
+			Seats:      lic.Seats,
+			ExpiryDate: lic.ExpiryDate,
+			Leases:     []*license.Lease{},
+		}
+		for _, l := range m.leases {
+			if l.AppID == appID {
+				pool.Leases = append(pool.Leases, clone(l))
+			}
+		}
+		sort.Slice(pool.Leases, func(i, j int) bool { return pool.Leases[i].IssuedAt.Before(pool.Leases[j].IssuedAt) })
+		pool.InUse = len(pool.Leases)
+		pools = append(pools, pool)
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].AppID < pools[j].AppID })
+	return pools
+}
+
+// renew extends and re-signs a lease, then persists the leases
+func (m *Manager) renew(lease *license.Lease, now time.Time) (*license.Lease, error) {
+	lease.IssuedAt = now
+	lease.ExpiresAt = now.Add(m.leaseTTL)
+	if err := lease.Sign(); err != nil {
+		return nil, err
+	}
+	return clone(lease), m.save()
+}
+
+// clone copies a lease so callers can use it after the lock is released
+func clone(l *license.Lease) *license.Lease {
+	c := *l
+	return &c
+}
+
+// lookup returns the lease if it belongs to the client
+func (m *Manager) lookup(leaseID, clientID string) (*license.Lease, error) {
+	lease, ok := m.leases[leaseID]
+	if !ok || lease.ClientID != clientID {
+		return nil, ErrLeaseNotFound
+	}
+	return lease, nil
+}
+
+// inUse counts the leases of an application
+func (m *Manager) inUse(appID string) int {
+	n := 0
+	for _, l := range m.leases {
+		if l.AppID == appID {
+			n++
+		}
+	}
+	return n
+}
+
+// expire drops leases that were not renewed in time
+func (m *Manager) expire(now time.Time) {
+	for id, l := range m.leases {
+		if now.After(l.ExpiresAt) {
+			delete(m.leases, id)
+		}
+	}
+}
+
+// save persists the current leases
+func (m *Manager) save() error {
+	if m.store == nil {
+		return nil
+	}
+
+	leases := make([]*license.Lease, 0, len(m.leases))
+	for _, l := range m.leases {
+		leases = append(leases, l)
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].ID < leases[j].ID })
+	return m.store.PutLeases(leases)
+}
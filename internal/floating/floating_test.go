@@ -0,0 +1,55 @@
+package floating
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/license"
+)
+
+func newTestManager(t *testing.T, seats int) *Manager {
+	t.Helper()
+	m, err := New(nil, time.Minute, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lic, err := license.NewFloatingLicense("server", "app", 30, nil, seats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddLicense(lic); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// Acquiring again while a lease is borrowed must not cut the borrow short
+// and free the seat
+func TestAcquireBorrowed(t *testing.T) {
+	m := newTestManager(t, 1)
+
+	lease, err := m.Acquire("app", "client", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	borrowed, err := m.Borrow(lease.ID, "client", 12*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := m.Acquire("app", "client", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Borrowed || !again.ExpiresAt.Equal(borrowed.ExpiresAt) {
+		t.Errorf("acquire returned a lease expiring %s, borrowed %v, want the borrow until %s",
+			again.ExpiresAt, again.Borrowed, borrowed.ExpiresAt)
+	}
+
+	// The seat stays taken after the lease time of a normal lease
+	m.expire(time.Now().UTC().Add(time.Hour))
+	if _, err := m.Acquire("app", "other", "user"); !errors.Is(err, ErrNoSeats) {
+		t.Errorf("acquire by another client: %v, want ErrNoSeats", err)
+	}
+}
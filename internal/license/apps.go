@@ -0,0 +1,142 @@
+package license
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SetApps lets the license cover more applications and signs it again.
+// appIDs are application IDs or glob patterns such as cf.suite.*, matched
+// with path.Match. appFeatures maps an app ID or pattern covered by the
+// license to the features only those applications get in addition to
+// Features.
+func (l *License) SetApps(appIDs []string, appFeatures map[string][]string) error {
+	for _, pattern := range appIDs {
+		if pattern == "" {
+			return errors.New("app ID cannot be empty")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid app ID pattern %q: %w", pattern, err)
+		}
+	}
+	covered := &License{AppID: l.AppID, AppIDs: appIDs}
+	for key := range appFeatures {
+		if !contains(appIDs, key) && !covered.CoversApp(key) {
+			return fmt.Errorf("features given for %q, which is not covered by the license", key)
+		}
+	}
+
+	l.AppIDs = appIDs
+	l.AppFeatures = appFeatures
+	return l.Sign()
+}
+
+// CoversApp reports whether the license is valid for the application,
+// either as its AppID or through one of its AppIDs
+func (l *License) CoversApp(appID string) bool {
+	if l.AppID == appID {
+		return true
+	}
+	for _, pattern := range l.AppIDs {
+		if MatchApp(pattern, appID) {
+			return true
+		}
+	}
+	return false
+}
+
+// FeaturesFor returns the features of the license for the application: the
+// common Features plus those given for every app ID or pattern matching it
+func (l *License) FeaturesFor(appID string) []string {
+	features := append([]string(nil), l.Features...)
+	for key, extra := range l.AppFeatures {
+		if !MatchApp(key, appID) {
+			continue
+		}
+		for _, f := range extra {
+			if !contains(features, f) {
+				features = append(features, f)
+			}
+		}
+	}
+	return features
+}
+
+// HasFeature reports whether the application may use the feature
+func (l *License) HasFeature(appID, feature string) bool {
+	return contains(l.FeaturesFor(appID), feature)
+}
+
+// LoadForApp finds the license of the calling application among the
+// license files (*.dat) in licenseDir, so that one directory can hold the
+// licenses of a whole suite. Licenses covering the application are
+// verified, and when several are valid the one expiring last is returned.
+// The timestamp is checked and updated once.
+func LoadForApp(licenseDir, timestampFilePath, currentMachineID, appID string) (*License, error) {
+	return LoadForAppBinding(licenseDir, timestampFilePath, LocalBinding(currentMachineID), appID)
+}
+
+// LoadForAppBinding is LoadForApp with a binding context, e.g. one holding
+// the instance count that unbound licenses need
+func LoadForAppBinding(licenseDir, timestampFilePath string, ctx BindingContext, appID string) (*License, error) {
+	if err := CheckTimestamp(timestampFilePath); err != nil {
+		return nil, fmt.Errorf("timestamp check failed: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(licenseDir, "*.dat"))
+	if err != nil {
+		return nil, err
+	}
+
+	var found *License
+	var verifyErr error
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load license: %w", err)
+		}
+		// Skip other files such as the timestamp, and trials which are
+		// started with StartTrial
+		lic, err := Decode(data)
+		if err != nil || lic.Signature == "" || lic.Trial || !lic.CoversApp(appID) {
+			continue
+		}
+
+		if err := lic.Verify(ctx, appID); err != nil {
+			if verifyErr == nil {
+				verifyErr = fmt.Errorf("%s: %w", filepath.Base(p), err)
+			}
+			continue
+		}
+		if found == nil || lic.ExpiryDate.After(found.ExpiryDate) {
+			found = lic
+		}
+	}
+
+	if found != nil {
+		return found, nil
+	}
+	if verifyErr != nil {
+		return nil, fmt.Errorf("license verification failed: %w", verifyErr)
+	}
+	return nil, fmt.Errorf("no license for %s in %s: %w", appID, licenseDir, ErrAppMismatch)
+}
+
+// IsAppPattern reports whether an entry of AppIDs is a glob pattern rather
+// than a single app ID
+func IsAppPattern(appID string) bool {
+	return strings.ContainsAny(appID, `*?[\`)
+}
+
+// MatchApp reports whether the app ID or glob pattern matches the app ID
+func MatchApp(pattern, appID string) bool {
+	if pattern == appID {
+		return true
+	}
+	ok, _ := path.Match(pattern, appID)
+	return ok
+}
@@ -0,0 +1,175 @@
+package license
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Binding types of a license
+const (
+	BindMachine = "machine" // Bound to MachineID, the default
+	BindHost    = "host"    // Bound to hostnames or wildcard domains
+	BindNetwork = "network" // Bound to IP ranges
+	BindUnbound = "unbound" // Runs anywhere, limited by MaxInstances
+)
+
+var (
+	ErrBindingMismatch   = errors.New("license does not match host or network binding")
+	ErrInstancesRequired = errors.New("unbound license needs the number of running instances")
+)
+
+// Binding declares what a license is bound to. Hardware bound licenses are
+// painful for server software in VMs, so a license can instead be bound to
+// hostnames such as app.example.com or *.example.com, to IP ranges in CIDR
+// notation, or be unbound with a maximum instance count.
+type Binding struct {
+	BindingType string   `json:"binding,omitempty"`   // One of the Bind constants, empty means BindMachine
+	Hostnames   []string `json:"hostnames,omitempty"` // For BindHost, *.example.com matches every subdomain
+	Networks    []string `json:"networks,omitempty"`  // For BindNetwork, e.g. 10.1.0.0/16
+}
+
+// BindingContext describes where a license is being verified
+type BindingContext struct {
+	MachineID string
+	Hostname  string
+	IPs       []net.IP
+	Instances int // Running instances of the application, required for unbound licenses
+}
+
+// LocalBinding returns the binding context of this machine: the given
+// machine ID, the hostname and the addresses of the network interfaces
+func LocalBinding(machineID string) BindingContext {
+	ctx := BindingContext{MachineID: machineID}
+	if hostname, err := os.Hostname(); err == nil {
+		ctx.Hostname = hostname
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				ctx.IPs = append(ctx.IPs, ipNet.IP)
+			}
+		}
+	}
+	return ctx
+}
+
+// Type returns the binding type, BindMachine when none is declared
+func (b Binding) Type() string {
+	if b.BindingType == "" {
+		return BindMachine
+	}
+	return b.BindingType
+}
+
+// Validate checks the binding type and its hostnames or networks
+func (b Binding) Validate() error {
+	switch b.Type() {
+	case BindMachine, BindUnbound:
+		if len(b.Hostnames) > 0 || len(b.Networks) > 0 {
+			return fmt.Errorf("%s binding takes no hostnames or networks", b.Type())
+		}
+	case BindHost:
+		if len(b.Hostnames) == 0 || len(b.Networks) > 0 {
+			return errors.New("host binding needs hostnames and no networks")
+		}
+		for _, h := range b.Hostnames {
+			if strings.TrimPrefix(h, "*.") == "" || strings.Contains(strings.TrimPrefix(h, "*."), "*") {
+				return fmt.Errorf("invalid hostname %q", h)
+			}
+		}
+	case BindNetwork:
+		if len(b.Networks) == 0 || len(b.Hostnames) > 0 {
+			return errors.New("network binding needs networks and no hostnames")
+		}
+		for _, n := range b.Networks {
+			if _, _, err := net.ParseCIDR(n); err != nil {
+				return fmt.Errorf("invalid network %q", n)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown binding type %q", b.BindingType)
+	}
+	return nil
+}
+
+// check verifies the binding against the context. Machine bindings report
+// ErrMachineMismatch like before bindings existed.
+func (b Binding) check(machineID string, ctx BindingContext) error {
+	switch b.Type() {
+	case BindMachine:
+		if machineID != ctx.MachineID {
+			return ErrMachineMismatch
+		}
+	case BindHost:
+		for _, h := range b.Hostnames {
+			if matchHostname(h, ctx.Hostname) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: hostname %q", ErrBindingMismatch, ctx.Hostname)
+	case BindNetwork:
+		for _, n := range b.Networks {
+			_, ipNet, err := net.ParseCIDR(n)
+			if err != nil {
+				return fmt.Errorf("invalid network in license: %w", err)
+			}
+			for _, ip := range ctx.IPs {
+				if ipNet.Contains(ip) {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("%w: no address in %v", ErrBindingMismatch, b.Networks)
+	case BindUnbound:
+		// Limited by MaxInstances, see License.Verify
+	default:
+		return fmt.Errorf("unknown binding type %q", b.BindingType)
+	}
+	return nil
+}
+
+// matchHostname matches a hostname against a hostname or *.domain pattern,
+// ignoring case and a trailing dot
+func matchHostname(pattern, hostname string) bool {
+	pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if hostname == "" {
+		return false
+	}
+	if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(hostname, "."+domain)
+	}
+	return pattern == hostname
+}
+
+// NewBoundLicense creates a license bound to hostnames or networks, or an
+// unbound one, instead of a machine. Unbound licenses must limit the
+// number of instances.
+func NewBoundLicense(binding Binding, appID string, expiryDays int, features []string, limits Limits) (*License, error) {
+	if err := binding.Validate(); err != nil {
+		return nil, err
+	}
+	if binding.Type() == BindMachine {
+		return nil, errors.New("machine bound licenses are created with NewLicense")
+	}
+	if binding.Type() == BindUnbound && limits.MaxInstances <= 0 {
+		return nil, errors.New("unbound licenses need a maximum instance count")
+	}
+	if err := limits.Validate(); err != nil {
+		return nil, err
+	}
+
+	license, err := newLicense("", appID, expiryDays, features)
+	if err != nil {
+		return nil, err
+	}
+	license.Binding = binding
+	license.Limits = limits
+	if err := license.Sign(); err != nil {
+		return nil, err
+	}
+	return license, nil
+}
@@ -0,0 +1,60 @@
+package license
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+)
+
+// Customer identifies who a license was sold to. All fields are optional
+// and signed with the license, so support can trust what a license.dat says
+// about its owner.
+type Customer struct {
+	CustomerName string            `json:"customer_name,omitempty"`
+	CustomerID   string            `json:"customer_id,omitempty"`
+	Contract     string            `json:"contract,omitempty"`      // Contract or order number
+	ContactEmail string            `json:"contact_email,omitempty"` // Contact of the customer for license matters
+	IssuedBy     string            `json:"issued_by,omitempty"`     // Person or client that issued the license
+	Metadata     map[string]string `json:"metadata,omitempty"`      // Free-form key/value pairs, e.g. region or reseller
+}
+
+// Validate checks the contact email and metadata keys
+func (c Customer) Validate() error {
+	if c.ContactEmail != "" {
+		if _, err := mail.ParseAddress(c.ContactEmail); err != nil {
+			return fmt.Errorf("invalid contact email %q", c.ContactEmail)
+		}
+	}
+	for key := range c.Metadata {
+		if key == "" {
+			return errors.New("metadata keys cannot be empty")
+		}
+	}
+	return nil
+}
+
+// IsZero reports whether no customer data is set
+func (c Customer) IsZero() bool {
+	return c.CustomerName == "" && c.CustomerID == "" && c.Contract == "" &&
+		c.ContactEmail == "" && c.IssuedBy == "" && len(c.Metadata) == 0
+}
+
+// MetadataKeys returns the sorted metadata keys
+func (c Customer) MetadataKeys() []string {
+	keys := make([]string, 0, len(c.Metadata))
+	for key := range c.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SetCustomer sets the customer data of the license and signs it again
+func (l *License) SetCustomer(c Customer) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	l.Customer = c
+	return l.Sign()
+}
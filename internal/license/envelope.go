@@ -0,0 +1,197 @@
+package license
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// EncryptionAES256GCM is the algorithm of encrypted license files
+const EncryptionAES256GCM = "A256GCM"
+
+var (
+	ErrNoEncryptionKey    = errors.New("encryption key is not loaded")
+	ErrDecryptLicense     = errors.New("failed to decrypt license")
+	ErrMultiAppEncryption = errors.New("licenses covering several applications cannot be encrypted")
+)
+
+// envelope is the content of an encrypted license file. The signed license
+// JSON is encrypted as a whole, only the app ID stays readable because the
+// key of each application is derived from it.
+type envelope struct {
+	Encryption string `json:"encryption"`
+	AppID      string `json:"app_id"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+var (
+	// encryptionMu guards the encryption keys
+	encryptionMu  sync.RWMutex
+	encryptionKey []byte            // Master key, see SetEncryptionKey
+	appKeys       map[string][]byte // Keys of single applications, see SetAppEncryptionKey
+)
+
+// SetEncryptionKey sets the master key of encrypted licenses. The licenses
+// of each application are encrypted with a key derived from the master key
+// and the app ID, see AppEncryptionKey.
+func SetEncryptionKey(key []byte) {
+	encryptionMu.Lock()
+	defer encryptionMu.Unlock()
+	encryptionKey = key
+}
+
+// LoadEncryptionKey reads a master key from a file, ignoring surrounding
+// whitespace
+func LoadEncryptionKey(filePath string) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return nil, errors.New("encryption key file is empty")
+	}
+	return []byte(key), nil
+}
+
+// SetAppEncryptionKey sets the key returned by AppEncryptionKey for one
+// application, so that the application can decrypt its licenses without
+// knowing the master key
+func SetAppEncryptionKey(appID string, key []byte) {
+	encryptionMu.Lock()
+	defer encryptionMu.Unlock()
+	if appKeys == nil {
+		appKeys = make(map[string][]byte)
+	}
+	appKeys[appID] = key
+}
+
+// AppEncryptionKey derives the 32 byte AES key of an application from the
+// master key
+func AppEncryptionKey(master []byte, appID string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("license encryption/" + appID))
+	return mac.Sum(nil)
+}
+
+// appEncryptionKey returns the key for the licenses of the application
+func appEncryptionKey(appID string) ([]byte, error) {
+	encryptionMu.RLock()
+	defer encryptionMu.RUnlock()
+	if key, ok := appKeys[appID]; ok {
+		return key, nil
+	}
+	if len(encryptionKey) == 0 {
+		return nil, ErrNoEncryptionKey
+	}
+	return AppEncryptionKey(encryptionKey, appID), nil
+}
+
+// CheckEncryptionKey reports whether licenses of the application can be
+// encrypted and decrypted
+func CheckEncryptionKey(appID string) error {
+	_, err := appEncryptionKey(appID)
+	return err
+}
+
+// newGCM returns AES-GCM for the key of the application
+func newGCM(appID string) (cipher.AEAD, error) {
+	key, err := appEncryptionKey(appID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key of %s: %w", appID, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncodeEncrypted returns the license file content encrypted with the key
+// of the license's application, so that features, limits and customer data
+// cannot be read without it. The signature is kept inside and verified
+// after Decode as usual. The other applications of a license with AppIDs
+// could not decrypt it with their own keys, so such licenses return
+// ErrMultiAppEncryption.
+func (l *License) EncodeEncrypted() ([]byte, error) {
+	if len(l.AppIDs) > 0 {
+		return nil, ErrMultiAppEncryption
+	}
+	data, err := l.Encode()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(l.AppID)
+	if err != nil {
+		return nil, err
+	}
+
+	env := envelope{
+		Encryption: EncryptionAES256GCM,
+		AppID:      l.AppID,
+		Nonce:      make([]byte, gcm.NonceSize()),
+	}
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return nil, err
+	}
+	env.Ciphertext = gcm.Seal(nil, env.Nonce, data, env.additionalData())
+	return json.Marshal(env)
+}
+
+// SaveEncrypted saves the license to a file like Save, encrypted with
+// EncodeEncrypted
+func (l *License) SaveEncrypted(filePath string) error {
+	data, err := l.EncodeEncrypted()
+	if err != nil {
+		return err
+	}
+	return writeLicenseFile(filePath, data)
+}
+
+// IsEncrypted reports whether license file content is encrypted
+func IsEncrypted(data []byte) bool {
+	_, ok := parseEnvelope(data)
+	return ok
+}
+
+// parseEnvelope parses the content of an encrypted license file
+func parseEnvelope(data []byte) (*envelope, bool) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Encryption == "" {
+		return nil, false
+	}
+	return &env, true
+}
+
+// decrypt returns the license JSON inside the envelope
+func (e *envelope) decrypt() ([]byte, error) {
+	if e.Encryption != EncryptionAES256GCM {
+		return nil, fmt.Errorf("unknown license encryption %q", e.Encryption)
+	}
+	gcm, err := newGCM(e.AppID)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != gcm.NonceSize() {
+		return nil, ErrDecryptLicense
+	}
+	data, err := gcm.Open(nil, e.Nonce, e.Ciphertext, e.additionalData())
+	if err != nil {
+		return nil, ErrDecryptLicense
+	}
+	return data, nil
+}
+
+// additionalData binds the readable fields to the ciphertext
+func (e *envelope) additionalData() []byte {
+	return []byte(e.Encryption + "/" + e.AppID)
+}
@@ -0,0 +1,129 @@
+package license
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultLeaseFile is the default file a borrowed lease is saved to
+const DefaultLeaseFile = "lease.dat"
+
+// leaseSignatureContext is the signWithContext context of leases
+const leaseSignatureContext = "lease\n"
+
+var (
+	ErrLeaseExpired  = errors.New("lease has expired")
+	ErrLeaseMismatch = errors.New("lease does not match current client")
+)
+
+// Lease is a time-limited checkout of one seat of a floating license. The
+// license server signs leases so that a borrowed lease can be verified
+// without contacting the server.
+type Lease struct {
+	ID        string    `json:"id"`
+	Serial    string    `json:"serial"` // Serial of the floating license
+	AppID     string    `json:"app_id"`
+	Features  []string  `json:"features,omitempty"`
+	ClientID  string    `json:"client_id"` // Machine ID of the client
+	User      string    `json:"user,omitempty"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Borrowed  bool      `json:"borrowed,omitempty"` // Checked out for offline use, no heartbeats needed
+	KeyID     string    `json:"key_id,omitempty"`   // ID of the signing key, see KeyID
+	Signature string    `json:"signature"`
+}
+
+// NewLeaseID returns a random lease ID
+func NewLeaseID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate lease ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign adds a signature to the lease
+func (l *Lease) Sign() error {
+	l.KeyID = KeyFingerprint()
+	sig, err := l.signature()
+	if err != nil {
+		return err
+	}
+	l.Signature = sig
+	return nil
+}
+
+// Verify checks the signature, client, application and expiry of the lease
+func (l *Lease) Verify(clientID, appID string) error {
+	unsigned := *l
+	unsigned.Signature = ""
+	if err := checkWithContext(leaseSignatureContext, &unsigned, l.KeyID, l.Signature); err != nil {
+		return err
+	}
+	if l.ClientID != clientID {
+		return ErrLeaseMismatch
+	}
+	if l.AppID != appID {
+		return ErrAppMismatch
+	}
+	if time.Now().UTC().After(l.ExpiresAt) {
+		return ErrLeaseExpired
+	}
+	return nil
+}
+
+// signature computes the HMAC of the lease with the signature cleared
+func (l *Lease) signature() (string, error) {
+	unsigned := *l
+	unsigned.Signature = ""
+	return signWithContext(leaseSignatureContext, &unsigned)
+}
+
+// Save saves a borrowed lease to a file
+func (l *Lease) Save(filePath string) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
+
+// LoadLease loads a lease from a file
+func LoadLease(filePath string) (*Lease, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var lease Lease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return nil, ErrInvalidLicense
+	}
+	return &lease, nil
+}
+
+// VerifyLeaseAndUpdate verifies a borrowed lease file and updates the
+// timestamp, like VerifyAndUpdate does for license files
+func VerifyLeaseAndUpdate(leaseFilePath, timestampFilePath, clientID, appID string) (*Lease, error) {
+	if err := CheckTimestamp(timestampFilePath); err != nil {
+		return nil, fmt.Errorf("timestamp check failed: %w", err)
+	}
+
+	lease, err := LoadLease(leaseFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lease: %w", err)
+	}
+	if err := lease.Verify(clientID, appID); err != nil {
+		return nil, fmt.Errorf("lease verification failed: %w", err)
+	}
+	return lease, nil
+}
@@ -0,0 +1,147 @@
+package license
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrLeaseLost is returned by Hold when the lease could not be renewed
+// before it expired
+var ErrLeaseLost = errors.New("lease lost")
+
+// LeaseClient checks out leases of a floating license from a license server
+type LeaseClient struct {
+	ServerURL  string       // License server URL, e.g. http://license.lab.local:8080
+	AppID      string       // Application the floating license is for
+	ClientID   string       // Machine ID of this client
+	User       string       // Optional user name, shown on the server
+	HTTPClient *http.Client // http.DefaultClient when nil
+}
+
+// leaseRequest is the body of the lease endpoints
+type leaseRequest struct {
+	AppID    string `json:"app_id,omitempty"`
+	ClientID string `json:"client_id"`
+	User     string `json:"user,omitempty"`
+	LeaseID  string `json:"lease_id,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// leaseResponse is the response of the lease endpoints
+type leaseResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Lease   *Lease `json:"lease,omitempty"`
+}
+
+// Acquire checks out a seat. Acquiring again while holding a lease returns
+// the same lease renewed.
+func (c *LeaseClient) Acquire(ctx context.Context) (*Lease, error) {
+	return c.call(ctx, "acquire", leaseRequest{AppID: c.AppID, ClientID: c.ClientID, User: c.User})
+}
+
+// Renew extends a lease by the server lease time. Call it regularly, Hold
+// does so automatically.
+func (c *LeaseClient) Renew(ctx context.Context, lease *Lease) (*Lease, error) {
+	return c.call(ctx, "renew", leaseRequest{ClientID: c.ClientID, LeaseID: lease.ID})
+}
+
+// Borrow extends a lease for offline use. The returned lease needs no
+// heartbeats; save it with Lease.Save and check it with VerifyLeaseAndUpdate
+// while disconnected.
+func (c *LeaseClient) Borrow(ctx context.Context, lease *Lease, d time.Duration) (*Lease, error) {
+	return c.call(ctx, "borrow", leaseRequest{ClientID: c.ClientID, LeaseID: lease.ID, Duration: d.String()})
+}
+
+// Release returns the seat to the server
+func (c *LeaseClient) Release(ctx context.Context, lease *Lease) error {
+	_, err := c.call(ctx, "release", leaseRequest{ClientID: c.ClientID, LeaseID: lease.ID})
+	return err
+}
+
+// Hold renews the lease until ctx is done and then releases it. Renewals
+// happen at a third of the lease time and failed renewals are retried until
+// the lease expires, then ErrLeaseLost is returned. onRenew, if not nil, is
+// called with every renewed lease.
+func (c *LeaseClient) Hold(ctx context.Context, lease *Lease, onRenew func(*Lease)) error {
+	interval := lease.ExpiresAt.Sub(lease.IssuedAt) / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return c.Release(releaseCtx, lease)
+		case <-ticker.C:
+		}
+
+		renewed, err := c.Renew(ctx, lease)
+		if err != nil {
+			if time.Now().UTC().After(lease.ExpiresAt) {
+				return fmt.Errorf("%w: %v", ErrLeaseLost, err)
+			}
+			getLogger().Warn("failed to renew lease, retrying", "lease_id", lease.ID, "error", err)
+			continue
+		}
+		lease = renewed
+		if onRenew != nil {
+			onRenew(lease)
+		}
+	}
+}
+
+// call posts to a lease endpoint and verifies the returned lease
+func (c *LeaseClient) call(ctx context.Context, action string, body leaseRequest) (*Lease, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimRight(c.ServerURL, "/") + "/api/v1/leases/" + action
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result leaseResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid response from license server: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || !result.Success {
+		return nil, fmt.Errorf("license server returned %d: %s", resp.StatusCode, result.Error)
+	}
+	if action == "release" {
+		return nil, nil
+	}
+
+	// Only accept leases signed with our key
+	if result.Lease == nil {
+		return nil, errors.New("license server returned no lease")
+	}
+	if err := result.Lease.Verify(c.ClientID, c.AppID); err != nil {
+		return nil, fmt.Errorf("license server returned an invalid lease: %w", err)
+	}
+	return result.Lease, nil
+}
@@ -2,14 +2,18 @@ package license
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,23 +31,43 @@ var (
 	ErrInvalidSignature      = errors.New("invalid license signature")
 	ErrSystemTimeManipulated = errors.New("system time has been manipulated")
 	ErrMachineMismatch       = errors.New("license does not match current machine")
+	ErrAppMismatch           = errors.New("license does not match application ID")
 	ErrTimeZoneManipulated   = errors.New("timezone has been changed since license creation")
+	ErrNoSigningKey          = errors.New("signing key is not loaded")
+	ErrUnknownSigningKey     = errors.New("license is signed with an unknown key")
 )
 
 // License represents a software license
 type License struct {
-	MachineID    string    `json:"machine_id"`    // Unique machine identifier
-	AppID        string    `json:"app_id"`        // Application identifier
-	ExpiryDate   time.Time `json:"expiry_date"`   // Expiration time
-	Features     []string  `json:"features"`      // Optional feature list
-	Signature    string    `json:"signature"`     // Digital signature
-	CreationDate time.Time `json:"creation_date"` // Creation time
-	TimeZone     string    `json:"time_zone"`     // Time zone when license was created
+	Serial         string    `json:"serial,omitempty"`          // Unique license serial number
+	MachineID      string    `json:"machine_id"`                // Unique machine identifier, empty unless machine bound
+	AppID          string    `json:"app_id"`                    // Application identifier
+	ExpiryDate     time.Time `json:"expiry_date"`               // Expiration time
+	Features       []string  `json:"features"`                  // Optional feature list
+	Signature      string    `json:"signature"`                 // Digital signature
+	KeyID          string    `json:"key_id,omitempty"`          // ID of the signing key, see KeyID
+	CreationDate   time.Time `json:"creation_date"`             // Creation time
+	TimeZone       string    `json:"time_zone"`                 // Time zone when license was created
+	Seats          int       `json:"seats,omitempty"`           // Concurrent leases of a floating license, 0 for node-locked
+	Trial          bool      `json:"trial,omitempty"`           // Self-issued from a trial policy on first run
+	Edition        string    `json:"edition,omitempty"`         // Catalog edition the license was issued for, e.g. pro
+	PreviousSerial string    `json:"previous_serial,omitempty"` // Serial of the license this one renews
+	OriginalSerial string    `json:"original_serial,omitempty"` // Serial of the first license of a renewal chain
+	MinVersion     string    `json:"min_version,omitempty"`     // Lowest application version covered, see SetVersionRange
+	MaxVersion     string    `json:"max_version,omitempty"`     // Highest application version covered, e.g. 2.x
+	Limits                   // Quantitative limits, checked with CheckLimits
+	Customer                 // Owner of the license, e.g. customer name and contract
+	Binding                  // Host, network or no binding instead of MachineID, see NewBoundLicense
+
+	// Further applications covered by the license, see SetApps
+	AppIDs      []string            `json:"app_ids,omitempty"`      // App IDs or glob patterns, e.g. cf.suite.*
+	AppFeatures map[string][]string `json:"app_features,omitempty"` // Extra features by app ID or pattern
 }
 
 // TimestampRecord used to prevent system time manipulation
 type TimestampRecord struct {
-	LastRun time.Time `json:"last_run"` // Last execution time
+	LastRun  time.Time            `json:"last_run"`           // Last execution time
+	Renewals map[string]time.Time `json:"renewals,omitempty"` // Creation time of the newest renewal seen, by original serial
 }
 
 // NewLicense creates a new license
@@ -51,6 +75,12 @@ func NewLicense(machineID string, appID string, expiryDays int, features []strin
 	if machineID == "" {
 		return nil, errors.New("machine ID cannot be empty")
 	}
+	return newLicense(machineID, appID, expiryDays, features)
+}
+
+// newLicense creates and signs a license for the machine, which is empty
+// for licenses with another binding
+func newLicense(machineID string, appID string, expiryDays int, features []string) (*License, error) {
 	if appID == "" {
 		return nil, errors.New("app ID cannot be empty")
 	}
@@ -59,7 +89,13 @@ func NewLicense(machineID string, appID string, expiryDays int, features []strin
 	now := time.Now().UTC()
 	expiryDate := now.AddDate(0, 0, expiryDays)
 
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
 	license := &License{
+		Serial:       serial,
 		MachineID:    machineID,
 		AppID:        appID,
 		ExpiryDate:   expiryDate,
@@ -76,35 +112,223 @@ func NewLicense(machineID string, appID string, expiryDays int, features []strin
 	return license, nil
 }
 
+// NewFloatingLicense creates a floating license bound to the license server
+// machine. The server hands out up to seats concurrent leases to clients.
+func NewFloatingLicense(serverMachineID string, appID string, expiryDays int, features []string, seats int) (*License, error) {
+	if seats <= 0 {
+		return nil, errors.New("seats must be positive")
+	}
+
+	license, err := NewLicense(serverMachineID, appID, expiryDays, features)
+	if err != nil {
+		return nil, err
+	}
+	license.Seats = seats
+	if err := license.Sign(); err != nil {
+		return nil, err
+	}
+	return license, nil
+}
+
+// Floating reports whether the license is a floating license
+func (l *License) Floating() bool {
+	return l.Seats > 0
+}
+
+// newSerial generates a random license serial number
+func newSerial() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate serial: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// logger receives the warnings of this package, nil means slog.Default()
+var logger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the logger used by this package
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// getLogger returns the injected logger or the default one
+func getLogger() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	return slog.Default()
+}
+
+var (
+	// keyMu guards SecretKey and previousKeys while a running server rotates keys
+	keyMu sync.RWMutex
+	// previousKeys only verify licenses, see RotateSecretKey and AddVerificationKey
+	previousKeys [][]byte
+)
+
+// signingKey returns the current signing key
+func signingKey() []byte {
+	keyMu.RLock()
+	defer keyMu.RUnlock()
+	return SecretKey
+}
+
+// SetSecretKey replaces the signing key, it is safe to call while licenses
+// are being signed or verified. Licenses signed with the replaced key no
+// longer verify, use RotateSecretKey to keep them valid.
+func SetSecretKey(key []byte) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	SecretKey = key
+}
+
+// RotateSecretKey makes key the signing key and keeps the current one for
+// verifying the licenses it signed. It reports false when key already is
+// the signing key.
+func RotateSecretKey(key []byte) bool {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	if hmac.Equal(key, SecretKey) {
+		return false
+	}
+	if len(SecretKey) > 0 {
+		previousKeys = append(previousKeys, SecretKey)
+	}
+	SecretKey = key
+	return true
+}
+
+// AddVerificationKey adds a key that verifies licenses but signs none, e.g.
+// the key used before a rotation in an earlier run of the server
+func AddVerificationKey(key []byte) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	previousKeys = append(previousKeys, key)
+}
+
+// verificationKeys returns the keys that may have signed a license with the
+// key ID, every known key for licenses signed before key IDs were recorded
+func verificationKeys(keyID string) [][]byte {
+	keyMu.RLock()
+	defer keyMu.RUnlock()
+	var keys [][]byte
+	for _, key := range append([][]byte{SecretKey}, previousKeys...) {
+		if len(key) > 0 && (keyID == "" || KeyID(key) == keyID) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// KeyID returns a short identifier of a signing key that can be logged and
+// stored in licenses without revealing the key
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeyFingerprint returns the KeyID of the current signing key
+func KeyFingerprint() string {
+	return KeyID(signingKey())
+}
+
+// CheckSigningKey reports whether a signing key is available
+func CheckSigningKey() error {
+	if len(signingKey()) == 0 {
+		return ErrNoSigningKey
+	}
+	return nil
+}
+
 // Sign adds a signature to the license
 func (l *License) Sign() error {
+	key := signingKey()
 	l.Signature = "" // Clear old signature
+	l.KeyID = KeyID(key)
 	data, err := json.Marshal(l)
 	if err != nil {
 		return err
 	}
 
 	// Calculate signature using HMAC-SHA256
-	h := hmac.New(sha256.New, SecretKey)
+	h := hmac.New(sha256.New, key)
 	h.Write(data)
 	signature := h.Sum(nil)
 	l.Signature = base64.StdEncoding.EncodeToString(signature)
 	return nil
 }
 
-// Verify checks if the license is valid
-func (l *License) Verify(currentMachineID string, appID string) error {
+// signWithContext returns the HMAC of v as JSON, prefixed with ctx so that
+// signatures of other documents made with the signing key, e.g. leases and
+// activation requests, can never be taken for license signatures
+func signWithContext(ctx string, v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(macWithContext(signingKey(), ctx, data)), nil
+}
+
+// checkWithContext verifies a signature made by signWithContext against
+// every key that may have signed v, like the signature of a license. v must
+// be the document with the signature cleared.
+func checkWithContext(ctx string, v any, keyID, signature string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	actualSignature, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	keys := verificationKeys(keyID)
+	if len(keys) == 0 {
+		return ErrUnknownSigningKey
+	}
+	for _, key := range keys {
+		if hmac.Equal(actualSignature, macWithContext(key, ctx, data)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// macWithContext returns the HMAC of ctx followed by data
+func macWithContext(key []byte, ctx string, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(ctx))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Verify checks if the license is valid where it runs. The context must
+// hold what the binding of the license needs: the machine ID for machine
+// bound licenses, the hostname or IP addresses for host or network bound
+// ones, see LocalBinding, and the running instances for unbound ones.
+func (l *License) Verify(ctx BindingContext, appID string) error {
 	// Get current time in UTC
 	now := time.Now().UTC()
 
-	// Verify machine ID
-	if l.MachineID != currentMachineID {
-		return ErrMachineMismatch
+	// Verify machine ID, hostname or network
+	if err := l.Binding.check(l.MachineID, ctx); err != nil {
+		return err
+	}
+
+	// Unbound licenses run anywhere, only the instance count limits them
+	if l.Binding.Type() == BindUnbound {
+		if ctx.Instances <= 0 {
+			return ErrInstancesRequired
+		}
+		if err := l.CheckLimits(Usage{Instances: ctx.Instances}); err != nil {
+			return err
+		}
 	}
 
-	// Verify app ID
-	if l.AppID != appID {
-		return errors.New("license does not match application ID")
+	// Verify app ID, the license may cover several applications
+	if !l.CoversApp(appID) {
+		return ErrAppMismatch
 	}
 
 	// Load the original timezone
@@ -118,7 +342,7 @@ func (l *License) Verify(currentMachineID string, appID string) error {
 
 	// Verify system time is not earlier than license creation time
 	if nowInOriginalTZ.Before(l.CreationDate) {
-		return errors.New("system time is earlier than license creation time - possible time manipulation detected")
+		return fmt.Errorf("system time is earlier than license creation time: %w", ErrSystemTimeManipulated)
 	}
 
 	// Convert expiry date to UTC for comparison
@@ -133,11 +357,17 @@ func (l *License) Verify(currentMachineID string, appID string) error {
 	currentTZ := time.Now().Location().String()
 	if currentTZ != l.TimeZone {
 		// Log the timezone change but don't fail validation
-		log.Printf("Warning: Current timezone (%s) differs from license creation timezone (%s)",
-			currentTZ, l.TimeZone)
+		getLogger().Warn("current timezone differs from license creation timezone",
+			"current_time_zone", currentTZ, "license_time_zone", l.TimeZone, "serial", l.Serial)
 	}
 
 	// Verify signature
+	return l.checkSignature()
+}
+
+// checkSignature verifies the signature of the license with the key that
+// signed it, which may have been rotated since
+func (l *License) checkSignature() error {
 	signature := l.Signature
 	l.Signature = ""
 	data, err := json.Marshal(l)
@@ -146,28 +376,64 @@ func (l *License) Verify(currentMachineID string, appID string) error {
 	}
 	l.Signature = signature
 
-	h := hmac.New(sha256.New, SecretKey)
-	h.Write(data)
-	expectedSignature := h.Sum(nil)
 	actualSignature, err := base64.StdEncoding.DecodeString(signature)
 	if err != nil {
 		return err
 	}
+	keys := verificationKeys(l.KeyID)
+	if len(keys) == 0 {
+		return ErrUnknownSigningKey
+	}
+	for _, key := range keys {
+		h := hmac.New(sha256.New, key)
+		h.Write(data)
+		if hmac.Equal(actualSignature, h.Sum(nil)) {
+			return nil
+		}
+	}
 
-	if !hmac.Equal(actualSignature, expectedSignature) {
-		return ErrInvalidSignature
+	return ErrInvalidSignature
+}
+
+// Encode returns the license file content
+func (l *License) Encode() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+// Decode parses license file content, decrypting it first when it was
+// saved with SaveEncrypted
+func Decode(data []byte) (*License, error) {
+	env, encrypted := parseEnvelope(data)
+	if encrypted {
+		var err error
+		if data, err = env.decrypt(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidLicense, err)
+		}
 	}
 
-	return nil
+	var license License
+	if err := json.Unmarshal(data, &license); err != nil {
+		return nil, ErrInvalidLicense
+	}
+	// The readable app ID of the envelope must not differ from the signed one
+	if encrypted && license.AppID != env.AppID {
+		return nil, ErrInvalidLicense
+	}
+
+	return &license, nil
 }
 
 // Save saves the license to a file
 func (l *License) Save(filePath string) error {
-	data, err := json.Marshal(l)
+	data, err := l.Encode()
 	if err != nil {
 		return err
 	}
+	return writeLicenseFile(filePath, data)
+}
 
+// writeLicenseFile writes license file content
+func writeLicenseFile(filePath string, data []byte) error {
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -189,19 +455,17 @@ func Load(filePath string) (*License, error) {
 		return nil, err
 	}
 
-	var license License
-	if err := json.Unmarshal(data, &license); err != nil {
-		return nil, ErrInvalidLicense
-	}
-
-	return &license, nil
+	return Decode(data)
 }
 
 // UpdateTimestamp updates the last run timestamp
 func UpdateTimestamp(filePath string) error {
-	record := TimestampRecord{
-		LastRun: time.Now(),
+	// Keep the renewals recorded by VerifyLatestAndUpdate
+	record, err := readTimestamp(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
+	record.LastRun = time.Now()
 
 	data, err := json.Marshal(record)
 	if err != nil {
@@ -217,6 +481,20 @@ func UpdateTimestamp(filePath string) error {
 	return os.WriteFile(filePath, data, 0644)
 }
 
+// readTimestamp reads the timestamp record, an empty record is returned
+// together with the error when the file cannot be read
+func readTimestamp(filePath string) (*TimestampRecord, error) {
+	var record TimestampRecord
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return &record, err
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return &record, err
+	}
+	return &record, nil
+}
+
 // CheckTimestamp checks the last run time to prevent system time manipulation
 func CheckTimestamp(filePath string) error {
 	data, err := os.ReadFile(filePath)
@@ -245,19 +523,37 @@ func CheckTimestamp(filePath string) error {
 
 // VerifyAndUpdate verifies the license and updates the timestamp
 func VerifyAndUpdate(licenseFilePath, timestampFilePath, currentMachineID, appID string) error {
+	// Read license file
+	data, err := os.ReadFile(licenseFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to load license: %w", err)
+	}
+
+	return VerifyDataAndUpdate(data, timestampFilePath, currentMachineID, appID)
+}
+
+// VerifyDataAndUpdate verifies license content on this machine and updates
+// the timestamp
+func VerifyDataAndUpdate(licenseData []byte, timestampFilePath, currentMachineID, appID string) error {
+	return VerifyBindingAndUpdate(licenseData, timestampFilePath, LocalBinding(currentMachineID), appID)
+}
+
+// VerifyBindingAndUpdate verifies license content against a binding
+// context, e.g. one reported by a client, and updates the timestamp
+func VerifyBindingAndUpdate(licenseData []byte, timestampFilePath string, ctx BindingContext, appID string) error {
 	// Check if system time has been manipulated
 	if err := CheckTimestamp(timestampFilePath); err != nil {
 		return fmt.Errorf("timestamp check failed: %w", err)
 	}
 
-	// Load license
-	license, err := Load(licenseFilePath)
+	// Decode license
+	license, err := Decode(licenseData)
 	if err != nil {
 		return fmt.Errorf("failed to load license: %w", err)
 	}
 
 	// Verify license
-	if err := license.Verify(currentMachineID, appID); err != nil {
+	if err := license.Verify(ctx, appID); err != nil {
 		return fmt.Errorf("license verification failed: %w", err)
 	}
 
@@ -0,0 +1,159 @@
+package license
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// useKeys restores the signing keys when the test ends
+func useKeys(t *testing.T, key []byte) {
+	t.Helper()
+	keyMu.Lock()
+	saved, savedPrevious := SecretKey, previousKeys
+	SecretKey, previousKeys = key, nil
+	keyMu.Unlock()
+	t.Cleanup(func() {
+		keyMu.Lock()
+		SecretKey, previousKeys = saved, savedPrevious
+		keyMu.Unlock()
+	})
+}
+
+func TestRotateSecretKey(t *testing.T) {
+	useKeys(t, []byte("old key"))
+	old, err := NewLicense("machine", "app", 30, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.KeyID != KeyID([]byte("old key")) {
+		t.Errorf("key ID %q, want the ID of the signing key", old.KeyID)
+	}
+
+	if !RotateSecretKey([]byte("new key")) {
+		t.Fatal("rotation to a new key reported no change")
+	}
+	if RotateSecretKey([]byte("new key")) {
+		t.Error("rotation to the current key reported a change")
+	}
+
+	// Licenses of the old key still verify and renew
+	if err := old.checkSignature(); err != nil {
+		t.Errorf("license of the rotated key: %v", err)
+	}
+	renewed, err := Renew(old, 30, nil, "")
+	if err != nil {
+		t.Fatalf("renew license of the rotated key: %v", err)
+	}
+	if renewed.KeyID != KeyID([]byte("new key")) {
+		t.Errorf("renewal signed with key %q, want the new key", renewed.KeyID)
+	}
+
+	// Replacing the key drops the old one
+	SetSecretKey([]byte("other key"))
+	keyMu.Lock()
+	previousKeys = nil
+	keyMu.Unlock()
+	if err := old.checkSignature(); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("license of a dropped key: %v, want ErrUnknownSigningKey", err)
+	}
+}
+
+func TestVerificationKey(t *testing.T) {
+	useKeys(t, []byte("old key"))
+	old, err := NewLicense("machine", "app", 30, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted server knows the old key only as a verification key
+	useKeys(t, []byte("new key"))
+	if err := old.checkSignature(); err == nil {
+		t.Fatal("license of an unknown key verified")
+	}
+	AddVerificationKey([]byte("old key"))
+	if err := old.checkSignature(); err != nil {
+		t.Errorf("license of a verification key: %v", err)
+	}
+
+	// Licenses signed before key IDs were recorded try every key
+	old.KeyID = ""
+	old.Signature = ""
+	data, err := json.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hmac.New(sha256.New, []byte("old key"))
+	h.Write(data)
+	old.Signature = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	if err := old.checkSignature(); err != nil {
+		t.Errorf("license without key ID: %v", err)
+	}
+}
+
+// Activation requests, leases and trial policies signed before a rotation
+// verify like licenses
+func TestRotateContextSignatures(t *testing.T) {
+	useKeys(t, []byte("old key"))
+	req, err := NewActivationRequest("machine", nil, "app", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewTrialPolicy("app", 30, nil, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease := &Lease{ID: "lease", AppID: "app", ClientID: "machine", ExpiresAt: time.Now().UTC().Add(time.Hour)}
+	if err := lease.Sign(); err != nil {
+		t.Fatal(err)
+	}
+
+	RotateSecretKey([]byte("new key"))
+	if err := req.Verify(); err != nil {
+		t.Errorf("activation request of the rotated key: %v", err)
+	}
+	if err := policy.Verify(); err != nil {
+		t.Errorf("trial policy of the rotated key: %v", err)
+	}
+	if err := lease.Verify("machine", "app"); err != nil {
+		t.Errorf("lease of the rotated key: %v", err)
+	}
+
+	lease.ClientID = "other"
+	if err := lease.Verify("other", "app"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered lease: %v, want ErrInvalidSignature", err)
+	}
+
+	keyMu.Lock()
+	previousKeys = nil
+	keyMu.Unlock()
+	if err := req.Verify(); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("activation request of a dropped key: %v, want ErrUnknownSigningKey", err)
+	}
+	if err := policy.Verify(); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("trial policy of a dropped key: %v, want ErrUnknownSigningKey", err)
+	}
+}
+
+// Unbound licenses only verify with an instance count within the limit
+func TestVerifyUnbound(t *testing.T) {
+	useKeys(t, []byte("key"))
+	lic, err := NewBoundLicense(Binding{BindingType: BindUnbound}, "app", 30, nil, Limits{MaxInstances: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lic.Verify(BindingContext{}, "app"); !errors.Is(err, ErrInstancesRequired) {
+		t.Errorf("verify without instances: %v, want ErrInstancesRequired", err)
+	}
+	if err := lic.Verify(BindingContext{Instances: 3}, "app"); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("verify beyond the limit: %v, want ErrLimitExceeded", err)
+	}
+	if err := lic.Verify(BindingContext{Instances: 2}, "app"); err != nil {
+		t.Errorf("verify within the limit: %v", err)
+	}
+}
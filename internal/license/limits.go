@@ -0,0 +1,137 @@
+package license
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+// Names of the quantitative limits
+const (
+	LimitCores     = "cores"
+	LimitUsers     = "users"
+	LimitInstances = "instances"
+)
+
+var ErrLimitExceeded = errors.New("license limit exceeded")
+
+// Limits are the signed quantitative limits of a license, 0 means unlimited
+type Limits struct {
+	MaxCores     int `json:"max_cores,omitempty"`     // CPU cores of the licensed machine
+	MaxUsers     int `json:"max_users,omitempty"`     // Named users of the application
+	MaxInstances int `json:"max_instances,omitempty"` // Running instances of the application
+}
+
+// Usage holds the runtime facts the limits are checked against
+type Usage struct {
+	Cores     int `json:"cores"`
+	Users     int `json:"users"`
+	Instances int `json:"instances"`
+}
+
+// LimitError reports which limit was exceeded. It matches ErrLimitExceeded
+// with errors.Is.
+type LimitError struct {
+	Limit  string // One of LimitCores, LimitUsers or LimitInstances
+	Max    int
+	Actual int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %d %s in use, the license allows at most %d", ErrLimitExceeded, e.Actual, e.Limit, e.Max)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Validate checks that no limit is negative
+func (l Limits) Validate() error {
+	if l.MaxCores < 0 || l.MaxUsers < 0 || l.MaxInstances < 0 {
+		return errors.New("limits cannot be negative")
+	}
+	return nil
+}
+
+// IsZero reports whether the license has no limits
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// SetLimits sets the limits of the license and signs it again
+func (l *License) SetLimits(limits Limits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	l.Limits = limits
+	return l.Sign()
+}
+
+// CheckLimits compares the usage with the limits of the license. The
+// license itself should have been verified first.
+func (l *License) CheckLimits(u Usage) error {
+	checks := []struct {
+		limit       string
+		max, actual int
+	}{
+		{LimitCores, l.MaxCores, u.Cores},
+		{LimitUsers, l.MaxUsers, u.Users},
+		{LimitInstances, l.MaxInstances, u.Instances},
+	}
+	for _, c := range checks {
+		if c.max > 0 && c.actual > c.max {
+			return &LimitError{Limit: c.limit, Max: c.max, Actual: c.actual}
+		}
+	}
+	return nil
+}
+
+// CheckUsage checks the limits against the CPU cores of this machine and
+// the user and instance counts supplied by the application
+func (l *License) CheckUsage(users, instances int) error {
+	u := Usage{Users: users, Instances: instances}
+	if l.MaxCores > 0 {
+		cores, err := CPUCores()
+		if err != nil {
+			return err
+		}
+		u.Cores = cores
+	}
+	return l.CheckLimits(u)
+}
+
+// CPUCores returns the number of physical CPU cores of this machine, or the
+// logical ones where physical cores cannot be determined (e.g. some VMs)
+func CPUCores() (int, error) {
+	cores, err := cpu.Counts(false)
+	if err != nil || cores == 0 {
+		cores, err = cpu.Counts(true)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to count CPU cores: %w", err)
+	}
+	return cores, nil
+}
+
+// VerifyUsageAndUpdate verifies the license like VerifyAndUpdate and then
+// checks its limits with CheckUsage. Unbound licenses can only be verified
+// this way, since they need the instance count.
+func VerifyUsageAndUpdate(licenseFilePath, timestampFilePath, currentMachineID, appID string, users, instances int) error {
+	data, err := os.ReadFile(licenseFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to load license: %w", err)
+	}
+	ctx := LocalBinding(currentMachineID)
+	ctx.Instances = instances
+	if err := VerifyBindingAndUpdate(data, timestampFilePath, ctx, appID); err != nil {
+		return err
+	}
+
+	license, err := Decode(data)
+	if err != nil {
+		return fmt.Errorf("failed to load license: %w", err)
+	}
+	return license.CheckUsage(users, instances)
+}
@@ -0,0 +1,125 @@
+package license
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+var ErrSupersededLicense = errors.New("license has been superseded by a renewed license")
+
+// Renew issues the successor of a license: the same machine, application,
+// edition, seats and limits with the expiry extended by extraDays and the
+// features added. Expired licenses can be renewed, the new validity then
+// starts today. The new license records the serial of prev in
+// PreviousSerial and the first serial of the chain in OriginalSerial, and
+// issuedBy, who renewed it, in IssuedBy.
+func Renew(prev *License, extraDays int, addFeatures []string, issuedBy string) (*License, error) {
+	if err := prev.checkSignature(); err != nil {
+		return nil, err
+	}
+	if extraDays < 0 {
+		return nil, errors.New("days cannot be negative")
+	}
+	if extraDays == 0 && len(addFeatures) == 0 {
+		return nil, errors.New("renewal must extend the expiry or add features")
+	}
+
+	now := time.Now().UTC()
+	start := prev.ExpiryDate.UTC()
+	if start.Before(now) {
+		start = now
+	}
+
+	features := append([]string(nil), prev.Features...)
+	for _, f := range addFeatures {
+		if !contains(features, f) {
+			features = append(features, f)
+		}
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	next := *prev
+	next.Serial = serial
+	next.PreviousSerial = prev.Serial
+	next.OriginalSerial = prev.Lineage()
+	next.ExpiryDate = start.AddDate(0, 0, extraDays)
+	next.Features = features
+	next.CreationDate = now
+	next.TimeZone = time.Now().Location().String()
+	next.IssuedBy = issuedBy
+	if err := next.Sign(); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// Lineage returns the serial identifying the renewal chain of the license,
+// the serial of its first license
+func (l *License) Lineage() string {
+	if l.OriginalSerial != "" {
+		return l.OriginalSerial
+	}
+	return l.Serial
+}
+
+// VerifyLatestAndUpdate verifies the license like VerifyAndUpdate and also
+// rejects it with ErrSupersededLicense when a newer license of its renewal
+// chain has been verified on this machine before, see CheckLatest.
+func VerifyLatestAndUpdate(licenseFilePath, timestampFilePath, currentMachineID, appID string) error {
+	if err := VerifyAndUpdate(licenseFilePath, timestampFilePath, currentMachineID, appID); err != nil {
+		return err
+	}
+
+	license, err := Load(licenseFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to load license: %w", err)
+	}
+	return license.CheckLatest(timestampFilePath)
+}
+
+// CheckLatest returns ErrSupersededLicense when a newer license of the
+// renewal chain of l has been seen on this machine. The newest renewal of
+// each chain is kept in the timestamp file, so that going back to an older
+// license file is detected without contacting the issuer.
+func (l *License) CheckLatest(timestampFilePath string) error {
+	record, err := readTimestamp(timestampFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	lineage := l.Lineage()
+	latest, seen := record.Renewals[lineage]
+	if seen && l.CreationDate.Before(latest) {
+		return fmt.Errorf("license verification failed: %w", ErrSupersededLicense)
+	}
+	if l.PreviousSerial == "" || (seen && !l.CreationDate.After(latest)) {
+		return nil
+	}
+
+	// Remember the renewal so that older licenses of the chain are rejected
+	if record.Renewals == nil {
+		record.Renewals = make(map[string]time.Time)
+	}
+	record.Renewals[lineage] = l.CreationDate
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(timestampFilePath, data, 0644)
+}
+
+// contains reports whether list contains s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package license
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chenwes/licensemodule/pkg/utils"
+)
+
+// DefaultRequestFile is the default file name of an offline activation request
+const DefaultRequestFile = "activation.req"
+
+// CompactRequestPrefix starts the compact encoding of an activation request.
+// The compact form only uses characters of the QR code alphanumeric mode.
+const CompactRequestPrefix = "LICREQ1:"
+
+// requestSignatureContext is the signWithContext context of activation requests
+const requestSignatureContext = "activation-request\n"
+
+// ErrInvalidRequest is returned for activation requests that cannot be
+// parsed, are not signed correctly or whose fingerprint does not match the
+// machine ID
+var ErrInvalidRequest = errors.New("invalid activation request")
+
+// ActivationRequest is produced on an offline machine and carried to the
+// vendor, who issues a license bound to the machine in return
+type ActivationRequest struct {
+	MachineID   string             `json:"machine_id"`
+	Fingerprint *utils.Fingerprint `json:"fingerprint,omitempty"` // Hardware the machine ID was derived from
+	AppID       string             `json:"app_id"`
+	Features    []string           `json:"features,omitempty"` // Requested features
+	Nonce       string             `json:"nonce"`
+	CreatedAt   time.Time          `json:"created_at"`
+	KeyID       string             `json:"key_id,omitempty"` // ID of the signing key, see KeyID
+	Signature   string             `json:"signature"`
+}
+
+// NewActivationRequest creates a signed activation request. fp may be nil
+// when the machine ID was not derived from hardware, e.g. in containers.
+func NewActivationRequest(machineID string, fp *utils.Fingerprint, appID string, features []string) (*ActivationRequest, error) {
+	if machineID == "" {
+		return nil, errors.New("machine ID cannot be empty")
+	}
+	if appID == "" {
+		return nil, errors.New("app ID cannot be empty")
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	req := &ActivationRequest{
+		MachineID:   machineID,
+		Fingerprint: fp,
+		AppID:       appID,
+		Features:    features,
+		Nonce:       hex.EncodeToString(b),
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+		KeyID:       KeyFingerprint(),
+	}
+	sig, err := req.signature()
+	if err != nil {
+		return nil, err
+	}
+	req.Signature = sig
+	return req, nil
+}
+
+// NewMachineActivationRequest creates a signed activation request for the
+// current machine. In containers the hardware may be unavailable, then the
+// container machine ID is used without a fingerprint.
+func NewMachineActivationRequest(container bool, appID string, features []string) (*ActivationRequest, error) {
+	fp, err := utils.GetFingerprint()
+	if err == nil {
+		return NewActivationRequest(fp.MachineID(), fp, appID, features)
+	}
+	if !container {
+		return nil, err
+	}
+
+	machineID, err := utils.GetContainerizedMachineID()
+	if err != nil {
+		return nil, err
+	}
+	return NewActivationRequest(machineID, nil, appID, features)
+}
+
+// Verify checks the signature of the request and that the fingerprint, if
+// present, produces the requested machine ID
+func (r *ActivationRequest) Verify() error {
+	unsigned := *r
+	unsigned.Signature = ""
+	if err := checkWithContext(requestSignatureContext, &unsigned, r.KeyID, r.Signature); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+	if r.Fingerprint != nil && r.Fingerprint.MachineID() != r.MachineID {
+		return fmt.Errorf("%w: fingerprint does not match machine ID", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// signature computes the HMAC of the request with the signature cleared
+func (r *ActivationRequest) signature() (string, error) {
+	unsigned := *r
+	unsigned.Signature = ""
+	return signWithContext(requestSignatureContext, &unsigned)
+}
+
+// Encode returns the request file content
+func (r *ActivationRequest) Encode() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// EncodeCompact returns the request as a single line of upper case letters,
+// digits and a colon, suitable for a QR code in alphanumeric mode
+func (r *ActivationRequest) EncodeCompact() (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return CompactRequestPrefix + compactEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+var compactEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ParseActivationRequest parses a request in either the file or the compact
+// encoding. The signature is not checked, call Verify for that.
+func ParseActivationRequest(data []byte) (*ActivationRequest, error) {
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, CompactRequestPrefix) {
+		raw, err := compactEncoding.DecodeString(strings.TrimPrefix(text, CompactRequestPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+		data, err = io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(raw)), 1<<20))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+	}
+
+	var req ActivationRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	return &req, nil
+}
+
+// Save writes the request file
+func (r *ActivationRequest) Save(filePath string) error {
+	data, err := r.Encode()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
+
+// LoadActivationRequest reads a request file in either encoding
+func LoadActivationRequest(filePath string) (*ActivationRequest, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseActivationRequest(data)
+}
@@ -0,0 +1,219 @@
+package license
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultTrialFile is the default file a trial license is saved to
+const DefaultTrialFile = "trial.dat"
+
+// trialPolicySignatureContext is the signWithContext context of trial policies
+const trialPolicySignatureContext = "trial-policy\n"
+
+var (
+	ErrInvalidTrialPolicy = errors.New("invalid trial policy")
+	ErrTrialExpired       = fmt.Errorf("trial %w", ErrExpiredLicense) // Matches ErrExpiredLicense
+	ErrTrialTampered      = errors.New("trial license has been tampered with")
+)
+
+// TrialPolicy is the vendor configuration of a self-issued trial. It is
+// signed by the vendor and compiled into the application, e.g. with
+// go:embed, so that users cannot change the trial terms.
+type TrialPolicy struct {
+	AppID     string   `json:"app_id"`
+	Days      int      `json:"days"`
+	Features  []string `json:"features,omitempty"`
+	Limits             // Quantitative limits of the trial
+	KeyID     string   `json:"key_id,omitempty"` // ID of the signing key, see KeyID
+	Signature string   `json:"signature"`
+}
+
+// NewTrialPolicy creates a signed trial policy
+func NewTrialPolicy(appID string, days int, features []string, limits Limits) (*TrialPolicy, error) {
+	if appID == "" {
+		return nil, errors.New("app ID cannot be empty")
+	}
+	if days <= 0 {
+		return nil, errors.New("trial days must be positive")
+	}
+	if err := limits.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := &TrialPolicy{AppID: appID, Days: days, Features: features, Limits: limits, KeyID: KeyFingerprint()}
+	sig, err := p.signature()
+	if err != nil {
+		return nil, err
+	}
+	p.Signature = sig
+	return p, nil
+}
+
+// ParseTrialPolicy decodes a trial policy and verifies its signature
+func ParseTrialPolicy(data []byte) (*TrialPolicy, error) {
+	var p TrialPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, ErrInvalidTrialPolicy
+	}
+	if err := p.Verify(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Verify checks the signature of the policy
+func (p *TrialPolicy) Verify() error {
+	unsigned := *p
+	unsigned.Signature = ""
+	if err := checkWithContext(trialPolicySignatureContext, &unsigned, p.KeyID, p.Signature); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTrialPolicy, err)
+	}
+	if p.AppID == "" || p.Days <= 0 {
+		return ErrInvalidTrialPolicy
+	}
+	return nil
+}
+
+// Encode returns the policy file content
+func (p *TrialPolicy) Encode() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// signature computes the HMAC of the policy with the signature cleared
+func (p *TrialPolicy) signature() (string, error) {
+	unsigned := *p
+	unsigned.Signature = ""
+	return signWithContext(trialPolicySignatureContext, &unsigned)
+}
+
+// StartTrial returns the trial license of this machine, issuing it from the
+// policy on first run. The trial is signed like a license and kept in
+// trialFilePath plus hidden copies in the user's directories, so deleting
+// the trial file does not restart the trial. When the copies disagree the
+// earliest trial wins. An expired trial is returned together with
+// ErrTrialExpired.
+func StartTrial(policy *TrialPolicy, machineID, trialFilePath string) (*License, error) {
+	if err := policy.Verify(); err != nil {
+		return nil, err
+	}
+
+	paths := trialPaths(trialFilePath, policy.AppID, machineID)
+	var trial *License
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trial: %w", err)
+		}
+
+		t, err := Decode(data)
+		if err == nil {
+			err = t.checkSignature()
+		}
+		if err != nil || !t.Trial {
+			return nil, fmt.Errorf("%w: %s", ErrTrialTampered, path)
+		}
+		if trial == nil || t.CreationDate.Before(trial.CreationDate) {
+			trial = t
+		}
+	}
+
+	if trial == nil {
+		var err error
+		trial, err = NewLicense(machineID, policy.AppID, policy.Days, policy.Features)
+		if err != nil {
+			return nil, err
+		}
+		trial.Trial = true
+		trial.Limits = policy.Limits
+		if err := trial.Sign(); err != nil {
+			return nil, err
+		}
+		getLogger().Info("trial started", "app_id", trial.AppID, "serial", trial.Serial,
+			"expiry_date", trial.ExpiryDate, "features", trial.Features)
+	}
+
+	if err := saveTrial(trial, paths); err != nil {
+		return nil, err
+	}
+
+	if err := trial.Verify(BindingContext{MachineID: machineID}, policy.AppID); err != nil {
+		if errors.Is(err, ErrExpiredLicense) {
+			return trial, ErrTrialExpired
+		}
+		return nil, fmt.Errorf("trial verification failed: %w", err)
+	}
+	return trial, nil
+}
+
+// VerifyOrTrial verifies the license file when it exists and falls back to
+// the trial of the policy otherwise, so installing a license.dat ends the
+// trial without further changes to the application. The timestamp is
+// checked and updated in both cases.
+func VerifyOrTrial(licenseFilePath, timestampFilePath, trialFilePath, currentMachineID string, policy *TrialPolicy) (*License, error) {
+	if _, err := os.Stat(licenseFilePath); err == nil {
+		if err := VerifyAndUpdate(licenseFilePath, timestampFilePath, currentMachineID, policy.AppID); err != nil {
+			return nil, err
+		}
+		return Load(licenseFilePath)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load license: %w", err)
+	}
+
+	if err := CheckTimestamp(timestampFilePath); err != nil {
+		return nil, fmt.Errorf("timestamp check failed: %w", err)
+	}
+	return StartTrial(policy, currentMachineID, trialFilePath)
+}
+
+// trialPaths returns the trial file and its hidden copies. The copies are
+// named after the application and machine so that trials of different
+// applications do not collide.
+func trialPaths(trialFilePath, appID, machineID string) []string {
+	sum := sha256.Sum256([]byte(appID + "|" + machineID))
+	name := "." + hex.EncodeToString(sum[:8])
+
+	paths := []string{trialFilePath}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "cf-license", name))
+	}
+	if dir, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return paths
+}
+
+// saveTrial writes the trial to every path that does not hold it yet. Only
+// the trial file itself must be written, the hidden copies are best effort.
+func saveTrial(trial *License, paths []string) error {
+	data, err := trial.Encode()
+	if err != nil {
+		return err
+	}
+
+	for i, path := range paths {
+		if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+			continue
+		}
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, data, 0644)
+		}
+		if err != nil {
+			if i == 0 {
+				return fmt.Errorf("failed to save trial: %w", err)
+			}
+			getLogger().Debug("failed to save trial copy", "path", path, "error", err)
+		}
+	}
+	return nil
+}
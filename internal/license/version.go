@@ -0,0 +1,187 @@
+package license
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrVersionOutOfRange = errors.New("application version is not covered by the license")
+
+// version is a parsed semantic version. Parts holds the major, minor and
+// patch numbers that were given, so 2.x has a single part.
+type version struct {
+	parts      []int
+	prerelease string
+}
+
+// parseVersion parses a semantic version such as v2.4.1-rc.1+build. When
+// partial is true, bounds like 2, 2.x or 2.4.* are accepted.
+func parseVersion(s string, partial bool) (version, error) {
+	var v version
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	s, _, _ = strings.Cut(s, "+") // Build metadata does not take part in comparisons
+	s, v.prerelease, _ = strings.Cut(s, "-")
+
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, f := range fields {
+		if partial && (f == "x" || f == "X" || f == "*") && i == len(fields)-1 && i > 0 && v.prerelease == "" {
+			break
+		}
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v.parts = append(v.parts, n)
+	}
+	if !partial && len(v.parts) != 3 {
+		return v, fmt.Errorf("invalid version %q, expected major.minor.patch", s)
+	}
+	return v, nil
+}
+
+// compare compares the first n numbers of two versions, and their
+// prerelease when all three numbers are compared
+func (v version) compare(o version, n int) int {
+	for i := 0; i < n; i++ {
+		a, b := v.part(i), o.part(i)
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	if n < 3 {
+		return 0
+	}
+	return comparePrerelease(v.prerelease, o.prerelease)
+}
+
+// part returns the i-th number of the version, missing numbers are 0
+func (v version) part(i int) int {
+	if i < len(v.parts) {
+		return v.parts[i]
+	}
+	return 0
+}
+
+// comparePrerelease compares prerelease identifiers like semver: a release
+// is newer than its prereleases, numeric identifiers compare as numbers
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case aErr == nil:
+			return -1 // Numeric identifiers sort before alphanumeric ones
+		case bErr == nil:
+			return 1
+		case as[i] < bs[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if len(as) < len(bs) {
+		return -1
+	}
+	return 1
+}
+
+// SetVersionRange restricts the license to application versions from min
+// up to max and signs it again. Either bound may be empty. Bounds may be
+// partial: min 2 means 2.0.0, max 2 or 2.x covers every 2.* version and
+// max 2.4 every 2.4.* version, while a full max like 2.4.1 is inclusive.
+func (l *License) SetVersionRange(min, max string) error {
+	var lo, hi version
+	var err error
+	if min != "" {
+		if lo, err = parseVersion(min, true); err != nil {
+			return fmt.Errorf("min version: %w", err)
+		}
+	}
+	if max != "" {
+		if hi, err = parseVersion(max, true); err != nil {
+			return fmt.Errorf("max version: %w", err)
+		}
+	}
+	if min != "" && max != "" && lo.compare(hi, len(hi.parts)) > 0 {
+		return fmt.Errorf("min version %s is above max version %s", min, max)
+	}
+
+	l.MinVersion = min
+	l.MaxVersion = max
+	return l.Sign()
+}
+
+// CheckVersion returns ErrVersionOutOfRange when the application version
+// is outside the version range of the license. Licenses without a range
+// accept every version.
+func (l *License) CheckVersion(appVersion string) error {
+	if l.MinVersion == "" && l.MaxVersion == "" {
+		return nil
+	}
+
+	v, err := parseVersion(appVersion, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVersionOutOfRange, err)
+	}
+	if l.MinVersion != "" {
+		lo, err := parseVersion(l.MinVersion, true)
+		if err != nil {
+			return fmt.Errorf("invalid min version in license: %w", err)
+		}
+		if v.compare(lo, 3) < 0 {
+			return fmt.Errorf("%w: %s is below %s", ErrVersionOutOfRange, appVersion, l.MinVersion)
+		}
+	}
+	if l.MaxVersion != "" {
+		hi, err := parseVersion(l.MaxVersion, true)
+		if err != nil {
+			return fmt.Errorf("invalid max version in license: %w", err)
+		}
+		if v.compare(hi, len(hi.parts)) > 0 {
+			return fmt.Errorf("%w: %s is above %s", ErrVersionOutOfRange, appVersion, l.MaxVersion)
+		}
+	}
+	return nil
+}
+
+// VerifyVersionAndUpdate verifies the license like VerifyAndUpdate and then
+// checks the version of the calling application with CheckVersion, e.g. the
+// version injected with -ldflags at build time
+func VerifyVersionAndUpdate(licenseFilePath, timestampFilePath, currentMachineID, appID, appVersion string) error {
+	if err := VerifyAndUpdate(licenseFilePath, timestampFilePath, currentMachineID, appID); err != nil {
+		return err
+	}
+
+	license, err := Load(licenseFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to load license: %w", err)
+	}
+	return license.CheckVersion(appVersion)
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/store"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var expiringDesc = prometheus.NewDesc(
+	"license_expiring_licenses",
+	"Number of issued licenses that expire within the given number of days.",
+	[]string{"within_days"}, nil,
+)
+
+// expiringCollector counts licenses in the store that are about to expire.
+// The store is scanned on every scrape.
+type expiringCollector struct {
+	store *store.Store
+	days  int
+}
+
+func (c *expiringCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- expiringDesc
+}
+
+func (c *expiringCollector) Collect(ch chan<- prometheus.Metric) {
+	records, err := c.store.ListRecords()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(expiringDesc, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	deadline := now.AddDate(0, 0, c.days)
+
+	count := 0
+	for _, rec := range records {
+		if rec.Revoked() {
+			continue
+		}
+		expiry := rec.License.ExpiryDate.UTC()
+		if expiry.After(now) && !expiry.After(deadline) {
+			count++
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(expiringDesc, prometheus.GaugeValue,
+		float64(count), strconv.Itoa(c.days))
+}
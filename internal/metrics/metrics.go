@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Verification results used as the "result" label
+const (
+	ResultOK              = "ok"
+	ResultExpired         = "expired"
+	ResultMachineMismatch = "machine_mismatch"
+	ResultBindingMismatch = "binding_mismatch"
+	ResultAppMismatch     = "app_mismatch"
+	ResultBadSignature    = "bad_signature"
+	ResultTimeManipulated = "time_manipulated"
+	ResultRevoked         = "revoked"
+	ResultLimitExceeded   = "limit_exceeded"
+	ResultSuperseded      = "superseded"
+	ResultVersionMismatch = "version_mismatch"
+	ResultInvalid         = "invalid"
+	ResultError           = "error"
+)
+
+// Metrics holds the Prometheus collectors of the license server.
+// All methods are safe to call on a nil *Metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	generated       *prometheus.CounterVec
+	verifications   *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+}
+
+// New creates the collectors. Licenses in st that expire within
+// expiringWithinDays are exported as a gauge.
+func New(st *store.Store, expiringWithinDays int) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		generated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "license_generated_total",
+			Help: "Number of licenses generated, by application ID.",
+		}, []string{"app_id"}),
+		verifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "license_verifications_total",
+			Help: "Number of license verifications, by result.",
+		}, []string{"result"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "license_http_request_duration_seconds",
+			Help:    "HTTP request latency, by route, method and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+	}
+
+	m.registry.MustRegister(
+		m.generated,
+		m.verifications,
+		m.requestDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if st != nil {
+		m.registry.MustRegister(&expiringCollector{store: st, days: expiringWithinDays})
+	}
+
+	return m
+}
+
+// Handler returns the /metrics handler
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// LicenseGenerated counts a generated license
+func (m *Metrics) LicenseGenerated(appID string) {
+	if m == nil {
+		return
+	}
+	m.generated.WithLabelValues(appID).Inc()
+}
+
+// Verification counts a verification with the result derived from err
+func (m *Metrics) Verification(err error) {
+	if m == nil {
+		return
+	}
+	m.verifications.WithLabelValues(VerifyResult(err)).Inc()
+}
+
+// Instrument records the latency of requests served by next under the given route
+func (m *Metrics) Instrument(route string, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		m.requestDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// VerifyResult maps a verification error to its result label using the
+// sentinel errors of the license and store packages
+func VerifyResult(err error) string {
+	switch {
+	case err == nil:
+		return ResultOK
+	case errors.Is(err, license.ErrExpiredLicense):
+		return ResultExpired
+	case errors.Is(err, license.ErrMachineMismatch):
+		return ResultMachineMismatch
+	case errors.Is(err, license.ErrBindingMismatch),
+		errors.Is(err, license.ErrInstancesRequired):
+		return ResultBindingMismatch
+	case errors.Is(err, license.ErrAppMismatch):
+		return ResultAppMismatch
+	case errors.Is(err, license.ErrInvalidSignature):
+		return ResultBadSignature
+	case errors.Is(err, license.ErrSystemTimeManipulated),
+		errors.Is(err, license.ErrTimeZoneManipulated):
+		return ResultTimeManipulated
+	case errors.Is(err, store.ErrRevoked):
+		return ResultRevoked
+	case errors.Is(err, license.ErrLimitExceeded):
+		return ResultLimitExceeded
+	case errors.Is(err, license.ErrSupersededLicense):
+		return ResultSuperseded
+	case errors.Is(err, license.ErrVersionOutOfRange):
+		return ResultVersionMismatch
+	case errors.Is(err, license.ErrInvalidLicense):
+		return ResultInvalid
+	}
+	return ResultError
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
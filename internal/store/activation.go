@@ -0,0 +1,168 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/activation"
+)
+
+// ActivationCode is a pre-issued product key that clients exchange for a
+// license bound to their machine. Only the hash of the code is stored, Code is
+// set when the code is created and when it is looked up by the code.
+type ActivationCode struct {
+	Code           string        `json:"code,omitempty"`
+	ID             string        `json:"id"` // activation.ID of the code, safe to show and log
+	AppID          string        `json:"app_id"`
+	Features       []string      `json:"features,omitempty"`
+	Edition        string        `json:"edition,omitempty"` // Catalog edition, Features and Days are already expanded
+	Days           int           `json:"days"`              // Validity of each license, counted from activation
+	MaxActivations int           `json:"max_activations"`   // Machines that may be active at the same time
+	CreatedAt      time.Time     `json:"created_at"`
+	CreatedBy      string        `json:"created_by,omitempty"`
+	Activations    []*Activation `json:"activations,omitempty"`
+}
+
+// Activation is a machine that activated a code
+type Activation struct {
+	MachineID     string     `json:"machine_id"`
+	Serial        string     `json:"serial"` // Serial of the last license issued to the machine
+	ActivatedAt   time.Time  `json:"activated_at"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+}
+
+// Active reports whether the activation still holds a seat
+func (a *Activation) Active() bool {
+	return a.DeactivatedAt == nil
+}
+
+// ActiveCount returns the number of machines currently holding a seat
+func (c *ActivationCode) ActiveCount() int {
+	n := 0
+	for _, a := range c.Activations {
+		if a.Active() {
+			n++
+		}
+	}
+	return n
+}
+
+// ActiveActivation returns the active activation of a machine, or nil
+func (c *ActivationCode) ActiveActivation(machineID string) *Activation {
+	for _, a := range c.Activations {
+		if a.Active() && a.MachineID == machineID {
+			return a
+		}
+	}
+	return nil
+}
+
+// PutActivationCode stores a new activation code. The file is named after the
+// hash of the code and the code itself is not written, so it never appears on
+// disk.
+func (s *Store) PutActivationCode(code *ActivationCode) error {
+	if code.Code == "" {
+		return errors.New("activation code is required")
+	}
+	code.ID = activation.ID(code.Code)
+	return s.writeActivationCode(code.Code, code)
+}
+
+// GetActivationCode returns the activation code, ignoring dashes and case
+func (s *Store) GetActivationCode(code string) (*ActivationCode, error) {
+	c, err := s.readActivationCode(s.activationFile(code))
+	if err != nil {
+		return nil, err
+	}
+	c.Code = code
+	return c, nil
+}
+
+// UpdateActivationCode loads the activation code, applies fn and stores the
+// result. Updates are serialized, so fn sees the latest activations. If fn
+// returns an error nothing is stored.
+func (s *Store) UpdateActivationCode(code string, fn func(*ActivationCode) error) (*ActivationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.GetActivationCode(code)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(c); err != nil {
+		return nil, err
+	}
+	if err := s.writeActivationCode(code, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListActivationCodes returns all activation codes, oldest first
+func (s *Store) ListActivationCodes() ([]*ActivationCode, error) {
+	dir := filepath.Join(s.dir, "activations")
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []*ActivationCode
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		c, err := s.readActivationCode(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].CreatedAt.Before(codes[j].CreatedAt) })
+	return codes, nil
+}
+
+func (s *Store) readActivationCode(path string) (*ActivationCode, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var c ActivationCode
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid activation code %s: %w", filepath.Base(path), err)
+	}
+	// Codes stored before only hashes were kept still contain the code, it is
+	// dropped the next time they are written
+	c.Code = ""
+	if c.ID == "" {
+		c.ID = strings.TrimSuffix(filepath.Base(path), ".json")[:16]
+	}
+	return &c, nil
+}
+
+// writeActivationCode stores c under the hash of code without the code itself
+func (s *Store) writeActivationCode(code string, c *ActivationCode) error {
+	stored := *c
+	stored.Code = ""
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	return writeFile(s.activationFile(code), data)
+}
+
+func (s *Store) activationFile(code string) string {
+	return filepath.Join(s.dir, "activations", activation.Hash(code)+".json")
+}
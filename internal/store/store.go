@@ -0,0 +1,401 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/license"
+)
+
+// DefaultDir is the default directory used for server-side state
+const DefaultDir = "data"
+
+// ErrNotFound is returned when a record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrRevoked is returned when a license has been revoked on the server
+var ErrRevoked = errors.New("license has been revoked")
+
+// Store manages the directory that holds server-side state
+type Store struct {
+	dir string
+	mu  sync.Mutex // Serializes read-modify-write updates of records
+}
+
+// Open opens the store rooted at dir, creating the directory if needed
+func Open(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, errors.New("store directory cannot be empty")
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(absDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	return &Store{dir: absDir}, nil
+}
+
+// Dir returns the absolute path of the store directory
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Ping checks that the store directory is reachable and writable
+func (s *Store) Ping() error {
+	f, err := os.CreateTemp(s.dir, ".ping-*")
+	if err != nil {
+		return fmt.Errorf("store is not writable: %w", err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// TimestampFile returns the path of the anti-rollback timestamp file kept for
+// a machine and application pair. Licenses without a machine binding pass
+// another owner, e.g. their serial. The IDs are hashed so that client input
+// can never escape the store directory.
+func (s *Store) TimestampFile(machineID, appID string) string {
+	hash := sha256.Sum256([]byte(machineID + "|" + appID))
+	return filepath.Join(s.dir, "timestamps", hex.EncodeToString(hash[:])+".dat")
+}
+
+// Record is an issued license kept by the store
+type Record struct {
+	License  *license.License `json:"license"`
+	IssuedBy string           `json:"issued_by,omitempty"` // Authenticated client that issued the license
+
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy    string     `json:"revoked_by,omitempty"`
+	RevokeReason string     `json:"revoke_reason,omitempty"`
+
+	SupersededBy string `json:"superseded_by,omitempty"` // Serial of the renewal of this license
+}
+
+// Revoked reports whether the license has been revoked
+func (r *Record) Revoked() bool {
+	return r.RevokedAt != nil
+}
+
+// PutRecord stores the record of an issued license
+func (s *Store) PutRecord(rec *Record) error {
+	path, err := s.recordFile(rec.License.Serial)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, data)
+}
+
+// DeleteRecord removes the record of a license that was never handed out,
+// e.g. a renewal whose audit event could not be written
+func (s *Store) DeleteRecord(serial string) error {
+	path, err := s.recordFile(serial)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// GetRecord returns the record of the license with the given serial
+func (s *Store) GetRecord(serial string) (*Record, error) {
+	path, err := s.recordFile(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("invalid license record %s: %w", serial, err)
+	}
+	if rec.License == nil {
+		return nil, fmt.Errorf("invalid license record %s: no license", serial)
+	}
+	return &rec, nil
+}
+
+// Revoke marks the license with the given serial as revoked. Revoking a
+// license twice keeps the first revocation.
+func (s *Store) Revoke(serial, by, reason string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err := s.GetRecord(serial)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Revoked() {
+		return rec, nil
+	}
+
+	now := time.Now().UTC()
+	rec.RevokedAt = &now
+	rec.RevokedBy = by
+	rec.RevokeReason = reason
+	if err := s.PutRecord(rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Supersede records that the license with the given serial was renewed as
+// the license with serial by. A license can only be superseded once, so
+// that its renewal chain does not fork.
+func (s *Store) Supersede(serial, by string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err := s.GetRecord(serial)
+	if err != nil {
+		return nil, err
+	}
+	if rec.SupersededBy != "" {
+		return nil, fmt.Errorf("%w: renewed as %s", license.ErrSupersededLicense, rec.SupersededBy)
+	}
+	rec.SupersededBy = by
+	if err := s.PutRecord(rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Unsupersede undoes Supersede when the renewal by serial could not be
+// completed. It does nothing if the license was renewed as another serial.
+func (s *Store) Unsupersede(serial, by string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err := s.GetRecord(serial)
+	if err != nil {
+		return err
+	}
+	if rec.SupersededBy != by {
+		return nil
+	}
+	rec.SupersededBy = ""
+	return s.PutRecord(rec)
+}
+
+// ListRecords returns all issued license records. Records that cannot be
+// read are logged and skipped, so one corrupt file does not hide the others.
+func (s *Store) ListRecords() ([]*Record, error) {
+	return s.listRecords(time.Time{})
+}
+
+// listRecords returns the records whose files were written at or after
+// since. A record is written when its license is issued, so records created
+// before since are skipped without reading them.
+func (s *Store) listRecords(since time.Time) ([]*Record, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, "licenses"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*Record
+	for _, e := range entries {
+		serial, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok {
+			continue
+		}
+		if !since.IsZero() {
+			if info, err := e.Info(); err == nil && info.ModTime().Before(since) {
+				continue
+			}
+		}
+		rec, err := s.GetRecord(serial)
+		if errors.Is(err, ErrNotFound) {
+			continue // Deleted since the directory was read
+		}
+		if err != nil {
+			slog.Warn("skipping unreadable license record", "serial", serial, "error", err)
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// Query selects license records by the customer data of the license.
+// Empty fields match every record, text fields are case-insensitive.
+type Query struct {
+	Customer string            // Part of the customer name, or the exact customer ID
+	Contract string            // Contract or order number
+	Email    string            // Contact email
+	Metadata map[string]string // Metadata values that must all be present
+	Text     string            // Part of any customer field or metadata value
+}
+
+// Match reports whether the license matches the query
+func (q Query) Match(lic *license.License) bool {
+	c := lic.Customer
+	if q.Customer != "" && !containsFold(c.CustomerName, q.Customer) && !strings.EqualFold(c.CustomerID, q.Customer) {
+		return false
+	}
+	if q.Contract != "" && !strings.EqualFold(c.Contract, q.Contract) {
+		return false
+	}
+	if q.Email != "" && !strings.EqualFold(c.ContactEmail, q.Email) {
+		return false
+	}
+	for key, value := range q.Metadata {
+		if v, ok := c.Metadata[key]; !ok || !strings.EqualFold(v, value) {
+			return false
+		}
+	}
+	if q.Text != "" {
+		fields := []string{c.CustomerName, c.CustomerID, c.Contract, c.ContactEmail, c.IssuedBy}
+		for _, v := range c.Metadata {
+			fields = append(fields, v)
+		}
+		found := false
+		for _, f := range fields {
+			if containsFold(f, q.Text) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns the issued license records matching the query
+func (s *Store) Search(q Query) ([]*Record, error) {
+	records, err := s.ListRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*Record
+	for _, rec := range records {
+		if q.Match(rec.License) {
+			found = append(found, rec)
+		}
+	}
+	return found, nil
+}
+
+// containsFold reports whether substr is within s, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// recordFile returns the record path for a serial, rejecting serials that
+// are not plain hex so they cannot escape the store directory
+func (s *Store) recordFile(serial string) (string, error) {
+	if _, err := hex.DecodeString(serial); err != nil || serial == "" {
+		return "", fmt.Errorf("invalid serial %q", serial)
+	}
+	return filepath.Join(s.dir, "licenses", serial+".json"), nil
+}
+
+// writeFile writes data through a temporary file and rename, so readers
+// never see a partially written file
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// IssuedSince returns the creation dates of the licenses issued to a machine
+// at or after since, oldest first
+func (s *Store) IssuedSince(machineID string, since time.Time) ([]time.Time, error) {
+	records, err := s.listRecords(since)
+	if err != nil {
+		return nil, err
+	}
+
+	var dates []time.Time
+	for _, rec := range records {
+		if rec.License.MachineID == machineID && !rec.License.CreationDate.Before(since) {
+			dates = append(dates, rec.License.CreationDate)
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates, nil
+}
+
+// PutLeases stores the leases of the floating licenses, replacing the
+// previous set
+func (s *Store) PutLeases(leases []*license.Lease) error {
+	data, err := json.Marshal(leases)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(s.dir, "leases.json"), data)
+}
+
+// Leases returns the stored leases of the floating licenses
+func (s *Store) Leases() ([]*license.Lease, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, "leases.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var leases []*license.Lease
+	if err := json.Unmarshal(data, &leases); err != nil {
+		return nil, fmt.Errorf("invalid leases file: %w", err)
+	}
+	return leases, nil
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chenwes/licensemodule/internal/license"
+)
+
+// A corrupt record is skipped instead of failing every listing and the
+// machine cap
+func TestListRecordsSkipsCorrupt(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	for _, serial := range []string{"0a", "0b"} {
+		lic := &license.License{Serial: serial, MachineID: "machine", CreationDate: now}
+		if err := s.PutRecord(&Record{License: lic}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{"0c.json": "{", "0d.json": "{}"} {
+		if err := os.WriteFile(filepath.Join(s.Dir(), "licenses", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := s.ListRecords()
+	if err != nil || len(records) != 2 {
+		t.Errorf("ListRecords returned %d records: %v, want 2", len(records), err)
+	}
+	dates, err := s.IssuedSince("machine", now.Add(-time.Hour))
+	if err != nil || len(dates) != 2 {
+		t.Errorf("IssuedSince returned %d dates: %v, want 2", len(dates), err)
+	}
+
+	// Records written before the period are not read
+	old := now.Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(s.Dir(), "licenses", "0a.json"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if dates, err := s.IssuedSince("machine", now.Add(-time.Hour)); err != nil || len(dates) != 1 {
+		t.Errorf("IssuedSince returned %d dates: %v, want 1", len(dates), err)
+	}
+}
@@ -0,0 +1,396 @@
+// Package client 是 License 服务 HTTP 接口的 Go 客户端，请求和响应类型与 /openapi.json 中的描述一致
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client License 服务客户端
+type Client struct {
+	// BaseURL 服务地址，例如 https://license.example.com
+	BaseURL string
+
+	// APIKey 不为空时通过 X-API-Key 头发送，签发接口开启认证时需要
+	APIKey string
+
+	// HTTPClient 为 nil 时使用 http.DefaultClient，使用客户端证书认证时在其中配置 TLS
+	HTTPClient *http.Client
+}
+
+// New 创建客户端
+func New(baseURL, apiKey string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), APIKey: apiKey}
+}
+
+// GenerateRequest 生成License的请求参数
+type GenerateRequest struct {
+	MachineID string   `json:"machine_id"`
+	AppID     string   `json:"app_id"`
+	Days      int      `json:"days,omitempty"`
+	Features  []string `json:"features,omitempty"`
+	Seats     int      `json:"seats,omitempty"`   // 大于0时签发浮动License
+	Edition   string   `json:"edition,omitempty"` // 产品目录中的版本
+
+	// 数量限制，0表示不限制
+	MaxCores     int `json:"max_cores,omitempty"`
+	MaxUsers     int `json:"max_users,omitempty"`
+	MaxInstances int `json:"max_instances,omitempty"`
+
+	// 同一License覆盖的其他应用，可以是应用ID或 cf.suite.* 形式的通配模式
+	AppIDs      []string            `json:"app_ids,omitempty"`
+	AppFeatures map[string][]string `json:"app_features,omitempty"` // 按应用ID或模式追加的功能
+
+	// 适用的应用版本范围，例如 MinVersion "2"、MaxVersion "2.x"
+	MinVersion string `json:"min_version,omitempty"`
+	MaxVersion string `json:"max_version,omitempty"`
+
+	// 客户和合同信息，随License签名；签发人由服务端记录为 API Key 的名称或客户端证书
+	CustomerName string            `json:"customer_name,omitempty"`
+	CustomerID   string            `json:"customer_id,omitempty"`
+	Contract     string            `json:"contract,omitempty"`
+	ContactEmail string            `json:"contact_email,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+
+	// 绑定方式：machine（默认）、host、network 或 unbound，后三者不需要 MachineID
+	Binding   string   `json:"binding,omitempty"`
+	Hostnames []string `json:"hostnames,omitempty"` // 主机名或 *.example.com
+	Networks  []string `json:"networks,omitempty"`  // 网段，例如 10.1.0.0/16
+
+	// 为 true 时返回以该应用密钥加密的 license.dat
+	Encrypt bool `json:"encrypt,omitempty"`
+}
+
+// RenewRequest 续期License的请求参数，License 为原 license.dat 的内容
+type RenewRequest struct {
+	License  []byte
+	Days     int      // 延长的天数，为0时只追加功能
+	Features []string // 追加的功能
+	Encrypt  bool     // 返回加密的 license.dat，原License已加密时总是加密
+}
+
+// VerifyRequest 验证License的请求参数，License 为 license.dat 的原始内容
+type VerifyRequest struct {
+	License   []byte
+	MachineID string
+	AppID     string
+	Usage     *Usage // 不为空时同时检查License的数量限制
+
+	AppVersion string // 应用版本，License限定了版本范围时必须提供
+
+	// 客户端的主机名和IP地址，用于绑定主机名或网段的License
+	Hostname string
+	IPs      []string
+}
+
+// Usage 客户端的核数、用户数和实例数
+type Usage struct {
+	Cores     int `json:"cores"`
+	Users     int `json:"users"`
+	Instances int `json:"instances"`
+}
+
+// Response 服务端统一的JSON响应格式
+type Response struct {
+	Success bool   `json:"success"`
+	Data    string `json:"data,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Code    string `json:"code,omitempty"`
+}
+
+// HealthResponse 存活检查的响应
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// ReadyResponse 就绪检查的响应
+type ReadyResponse struct {
+	Status    string            `json:"status"`
+	Version   string            `json:"version,omitempty"`
+	GitCommit string            `json:"git_commit,omitempty"`
+	Checks    map[string]string `json:"checks,omitempty"`
+}
+
+// ActivationCode 激活码及其激活记录
+type ActivationCode struct {
+	Code           string        `json:"code,omitempty"` // 只在创建时返回，服务端只保存激活码的哈希
+	ID             string        `json:"id"`
+	AppID          string        `json:"app_id"`
+	Features       []string      `json:"features,omitempty"`
+	Edition        string        `json:"edition,omitempty"`
+	Days           int           `json:"days"`
+	MaxActivations int           `json:"max_activations"`
+	CreatedAt      time.Time     `json:"created_at"`
+	CreatedBy      string        `json:"created_by,omitempty"`
+	Activations    []*Activation `json:"activations,omitempty"`
+}
+
+// Activation 使用激活码激活的机器
+type Activation struct {
+	MachineID     string     `json:"machine_id"`
+	Serial        string     `json:"serial"`
+	ActivatedAt   time.Time  `json:"activated_at"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+}
+
+// CreateActivationCodesRequest 创建激活码的请求参数
+type CreateActivationCodesRequest struct {
+	AppID          string   `json:"app_id"`
+	Features       []string `json:"features,omitempty"`
+	Edition        string   `json:"edition,omitempty"`
+	Days           int      `json:"days,omitempty"`
+	MaxActivations int      `json:"max_activations,omitempty"`
+	Count          int      `json:"count,omitempty"`
+}
+
+// APIError 服务端返回的非 2xx 响应
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("license server returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("license server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// VerificationError License验证未通过，Code 为失败原因，例如 expired、machine_mismatch
+type VerificationError struct {
+	Code    string
+	Message string
+}
+
+func (e *VerificationError) Error() string {
+	if e.Message == "" {
+		return "license verification failed: " + e.Code
+	}
+	return e.Message
+}
+
+// IsStatus 判断 err 是否为指定状态码的 APIError
+func IsStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// Generate 生成License，返回 license.dat 的内容
+func (c *Client) Generate(ctx context.Context, req GenerateRequest) ([]byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/license/generate", "application/json", bytes.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	return []byte(resp.Data), nil
+}
+
+// Renew 续期License，返回新 license.dat 的内容。
+// 原License已续期过时返回状态码为 409 的 *APIError
+func (c *Client) Renew(ctx context.Context, req RenewRequest) ([]byte, error) {
+	body, err := json.Marshal(struct {
+		License  string   `json:"license"`
+		Days     int      `json:"days,omitempty"`
+		Features []string `json:"features,omitempty"`
+		Encrypt  bool     `json:"encrypt,omitempty"`
+	}{string(req.License), req.Days, req.Features, req.Encrypt})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/license/renew", "application/json", bytes.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	return []byte(resp.Data), nil
+}
+
+// Verify 验证License，验证未通过时返回 *VerificationError
+func (c *Client) Verify(ctx context.Context, req VerifyRequest) error {
+	body, err := json.Marshal(struct {
+		License   string `json:"license"`
+		MachineID string `json:"machine_id"`
+		AppID     string `json:"app_id,omitempty"`
+		Usage     *Usage `json:"usage,omitempty"`
+
+		AppVersion string   `json:"app_version,omitempty"`
+		Hostname   string   `json:"hostname,omitempty"`
+		IPs        []string `json:"ips,omitempty"`
+	}{string(req.License), req.MachineID, req.AppID, req.Usage, req.AppVersion, req.Hostname, req.IPs})
+	if err != nil {
+		return err
+	}
+
+	var resp Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/license/verify", "application/json", bytes.NewReader(body), &resp); err != nil {
+		return err
+	}
+	if !resp.Success {
+		return &VerificationError{Code: resp.Code, Message: resp.Error}
+	}
+	return nil
+}
+
+// Activate 使用激活码为机器换取License，返回 license.dat 的内容。
+// 激活数量已满时返回状态码为 409 的 *APIError
+func (c *Client) Activate(ctx context.Context, code, machineID string) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{"code": code, "machine_id": machineID})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/activate", "application/json", bytes.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	return []byte(resp.Data), nil
+}
+
+// ActivateOffline 为离线激活请求签发License，request 为请求文件内容或其紧凑编码，
+// days 为0时使用服务端默认有效期
+func (c *Client) ActivateOffline(ctx context.Context, request []byte, days int) ([]byte, error) {
+	path := "/api/v1/activate/offline"
+	if days != 0 {
+		path += "?days=" + strconv.Itoa(days)
+	}
+
+	var resp Response
+	if err := c.do(ctx, http.MethodPost, path, "application/octet-stream", bytes.NewReader(request), &resp); err != nil {
+		return nil, err
+	}
+	return []byte(resp.Data), nil
+}
+
+// Deactivate 释放机器占用的激活数量，该机器的License会被吊销
+func (c *Client) Deactivate(ctx context.Context, code, machineID string) error {
+	body, err := json.Marshal(map[string]string{"code": code, "machine_id": machineID})
+	if err != nil {
+		return err
+	}
+
+	var resp Response
+	return c.do(ctx, http.MethodPost, "/api/v1/deactivate", "application/json", bytes.NewReader(body), &resp)
+}
+
+// CreateActivationCodes 创建激活码
+func (c *Client) CreateActivationCodes(ctx context.Context, req CreateActivationCodesRequest) ([]*ActivationCode, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Codes []*ActivationCode `json:"codes"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/activation-codes", "application/json", bytes.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Codes, nil
+}
+
+// ListActivationCodes 列出激活码，appID 不为空时只返回该应用的激活码
+func (c *Client) ListActivationCodes(ctx context.Context, appID string) ([]*ActivationCode, error) {
+	path := "/api/v1/activation-codes"
+	if appID != "" {
+		path += "?app_id=" + url.QueryEscape(appID)
+	}
+
+	var resp struct {
+		Codes []*ActivationCode `json:"codes"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Codes, nil
+}
+
+// MachineID 获取服务所在机器的ID，container 为 true 时使用容器环境的获取方式
+func (c *Client) MachineID(ctx context.Context, container bool) (string, error) {
+	path := "/api/v1/machine-id"
+	if container {
+		path += "?container=true"
+	}
+
+	var resp Response
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Data, nil
+}
+
+// Health 存活检查
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	var resp HealthResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/health", "", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Ready 就绪检查，服务未就绪时返回状态码为 503 的 *APIError
+func (c *Client) Ready(ctx context.Context) (*ReadyResponse, error) {
+	var resp ReadyResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/ready", "", nil, &resp); err != nil {
+		return &resp, err
+	}
+	return &resp, nil
+}
+
+// 发送请求并解析JSON响应，非 2xx 响应转换为 *APIError
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.BaseURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var r Response
+		if json.Unmarshal(data, &r) == nil {
+			apiErr.Message = r.Error
+		}
+		// 就绪检查未通过时仍然解析检查结果
+		json.Unmarshal(data, v)
+		return apiErr
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chenwes/licensemodule/api"
+	"github.com/chenwes/licensemodule/internal/license"
+	"github.com/chenwes/licensemodule/internal/store"
+	"github.com/chenwes/licensemodule/pkg/client"
+)
+
+// 客户端发出的一次请求
+type recordedRequest struct {
+	method, path, contentType string
+	body                      []byte
+}
+
+// 记录客户端请求的服务端
+type recorder struct {
+	mu       sync.Mutex
+	requests []recordedRequest
+	next     http.Handler
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	rec.mu.Lock()
+	rec.requests = append(rec.requests, recordedRequest{r.Method, r.URL.Path, r.Header.Get("Content-Type"), body})
+	rec.mu.Unlock()
+	rec.next.ServeHTTP(w, r)
+}
+
+// 创建进程内服务和指向它的客户端
+func newTestClient(t *testing.T) (*client.Client, *api.Server, *recorder) {
+	t.Helper()
+	st, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &api.Server{Store: st, DefaultDays: 30}
+	rec := &recorder{next: s.Handler()}
+	ts := httptest.NewServer(rec)
+	t.Cleanup(ts.Close)
+
+	c := client.New(ts.URL, "")
+	c.HTTPClient = ts.Client()
+	return c, s, rec
+}
+
+// 客户端的每个方法都能调用服务端，并且请求的路径、内容类型和字段都在 OpenAPI 文档中
+func TestClientContract(t *testing.T) {
+	c, s, rec := newTestClient(t)
+	ctx := context.Background()
+
+	if _, err := c.Health(ctx); err != nil {
+		t.Errorf("Health: %v", err)
+	}
+	if _, err := c.Ready(ctx); err != nil {
+		t.Errorf("Ready: %v", err)
+	}
+	// 沙箱中可能取不到机器ID，只关心请求是否符合文档
+	c.MachineID(ctx, true)
+
+	data, err := c.Generate(ctx, client.GenerateRequest{MachineID: "machine", AppID: "app", Days: 10, Features: []string{"report"}, CustomerName: "ACME"})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if err := c.Verify(ctx, client.VerifyRequest{License: data, MachineID: "machine", AppID: "app", Usage: &client.Usage{Users: 1}}); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	renewed, err := c.Renew(ctx, client.RenewRequest{License: data, Days: 10, Features: []string{"export"}})
+	if err != nil {
+		t.Errorf("Renew: %v", err)
+	}
+	if _, err := c.Renew(ctx, client.RenewRequest{License: data, Days: 10}); !client.IsStatus(err, http.StatusConflict) {
+		t.Errorf("second Renew: %v, want status %d", err, http.StatusConflict)
+	}
+	if lic, err := license.Decode(renewed); err != nil || lic.MachineID != "machine" {
+		t.Errorf("renewed license: %v", err)
+	}
+
+	codes, err := c.CreateActivationCodes(ctx, client.CreateActivationCodesRequest{AppID: "app", Days: 10, MaxActivations: 1})
+	if err != nil || len(codes) != 1 {
+		t.Fatalf("CreateActivationCodes: %v", err)
+	}
+	if _, err := c.Activate(ctx, codes[0].Code, "machine-2"); err != nil {
+		t.Errorf("Activate: %v", err)
+	}
+	if _, err := c.Activate(ctx, codes[0].Code, "machine-3"); !client.IsStatus(err, http.StatusConflict) {
+		t.Errorf("Activate beyond the limit: %v, want status %d", err, http.StatusConflict)
+	}
+	listed, err := c.ListActivationCodes(ctx, "app")
+	if err != nil || len(listed) != 1 || len(listed[0].Activations) != 1 {
+		t.Fatalf("ListActivationCodes: %v", err)
+	}
+	if listed[0].Code != "" || listed[0].ID == "" || listed[0].ID != codes[0].ID {
+		t.Errorf("listed code %q with ID %q, want only the ID %q", listed[0].Code, listed[0].ID, codes[0].ID)
+	}
+	if err := c.Deactivate(ctx, codes[0].Code, "machine-2"); err != nil {
+		t.Errorf("Deactivate: %v", err)
+	}
+
+	req, err := license.NewActivationRequest("machine-4", nil, "app", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := req.EncodeCompact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ActivateOffline(ctx, []byte(compact), 10); err != nil {
+		t.Errorf("ActivateOffline: %v", err)
+	}
+
+	checkDocumented(t, s.OpenAPI(), rec.requests)
+}
+
+// 检查请求是否与 OpenAPI 文档一致
+func checkDocumented(t *testing.T, doc map[string]any, requests []recordedRequest) {
+	t.Helper()
+	// 经过JSON往返，和客户端看到的 /openapi.json 一致
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.1.") {
+		t.Errorf("openapi %q, the mutualTLS security scheme needs 3.1", spec.OpenAPI)
+	}
+
+	for _, r := range requests {
+		op, ok := spec.Paths[r.path][strings.ToLower(r.method)]
+		if !ok {
+			t.Errorf("%s %s is not documented", r.method, r.path)
+			continue
+		}
+		if len(r.body) == 0 {
+			continue
+		}
+
+		body, _ := op["requestBody"].(map[string]any)
+		content, _ := body["content"].(map[string]any)
+		media, ok := content[r.contentType].(map[string]any)
+		if !ok {
+			t.Errorf("%s %s: content type %q is not documented", r.method, r.path, r.contentType)
+			continue
+		}
+		if r.contentType != "application/json" {
+			continue
+		}
+
+		// 请求中的每个字段都要在 schema 中声明
+		schema, _ := media["schema"].(map[string]any)
+		if name, ok := schema["$ref"].(string); ok {
+			schema = spec.Components.Schemas[strings.TrimPrefix(name, "#/components/schemas/")]
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		var fields map[string]any
+		if err := json.Unmarshal(r.body, &fields); err != nil {
+			t.Errorf("%s %s: body is not a JSON object: %v", r.method, r.path, err)
+			continue
+		}
+		for field := range fields {
+			if _, ok := properties[field]; !ok {
+				t.Errorf("%s %s: field %q is not documented", r.method, r.path, field)
+			}
+		}
+	}
+}
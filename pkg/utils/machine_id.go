@@ -13,18 +13,37 @@ import (
 	"github.com/shirou/gopsutil/v3/host"
 )
 
+// Fingerprint 计算机器ID所用的硬件信息，用于离线激活请求中供厂商核对
+type Fingerprint struct {
+	HostID         string `json:"host_id,omitempty"`         // 主板ID
+	Platform       string `json:"platform,omitempty"`        // 平台信息
+	PlatformFamily string `json:"platform_family,omitempty"` // 平台系列
+	CPU            string `json:"cpu,omitempty"`             // CPU信息
+	MAC            string `json:"mac,omitempty"`             // 物理网卡MAC
+	Hostname       string `json:"hostname,omitempty"`        // 主机名，仅供参考，不参与机器ID计算
+}
+
 // GetMachineID 返回基于MAC地址和CPU信息的唯一机器标识
 func GetMachineID() (string, error) {
+	fp, err := GetFingerprint()
+	if err != nil {
+		return "", err
+	}
+	return fp.MachineID(), nil
+}
+
+// GetFingerprint 返回当前机器的硬件信息
+func GetFingerprint() (*Fingerprint, error) {
 	// 获取主板序列号或BIOS信息
 	hostInfo, err := host.Info()
 	if err != nil {
-		return "", fmt.Errorf("failed to get host info: %w", err)
+		return nil, fmt.Errorf("failed to get host info: %w", err)
 	}
 
 	// 获取CPU信息
 	cpuInfo, err := cpu.Info()
 	if err != nil {
-		return "", fmt.Errorf("failed to get CPU info: %w", err)
+		return nil, fmt.Errorf("failed to get CPU info: %w", err)
 	}
 
 	var cpuID string
@@ -35,7 +54,7 @@ func GetMachineID() (string, error) {
 	// 获取第一个物理网卡的MAC地址
 	interfaces, err := net.Interfaces()
 	if err != nil {
-		return "", fmt.Errorf("failed to get network interfaces: %w", err)
+		return nil, fmt.Errorf("failed to get network interfaces: %w", err)
 	}
 
 	var physicalMAC string
@@ -54,13 +73,25 @@ func GetMachineID() (string, error) {
 		}
 	}
 
+	return &Fingerprint{
+		HostID:         hostInfo.HostID,
+		Platform:       hostInfo.Platform,
+		PlatformFamily: hostInfo.PlatformFamily,
+		CPU:            cpuID,
+		MAC:            physicalMAC,
+		Hostname:       hostInfo.Hostname,
+	}, nil
+}
+
+// MachineID 根据硬件信息计算机器ID
+func (f *Fingerprint) MachineID() string {
 	// 组合多个硬件标识符
 	idComponents := []string{
-		hostInfo.HostID,         // 主板ID
-		hostInfo.Platform,       // 平台信息
-		hostInfo.PlatformFamily, // 平台系列
-		cpuID,                   // CPU信息
-		physicalMAC,             // 物理网卡MAC
+		f.HostID,
+		f.Platform,
+		f.PlatformFamily,
+		f.CPU,
+		f.MAC,
 	}
 
 	// 过滤掉空值
@@ -77,7 +108,7 @@ func GetMachineID() (string, error) {
 	// 组合并计算哈希
 	idStr := strings.Join(validComponents, "|")
 	hash := sha256.Sum256([]byte(idStr))
-	return hex.EncodeToString(hash[:]), nil
+	return hex.EncodeToString(hash[:])
 }
 
 // GetContainerizedMachineID 返回一个可在容器环境中使用的机器标识
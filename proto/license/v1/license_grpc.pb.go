@@ -0,0 +1,326 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: license/v1/license.proto
+
+package licensev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	LicenseService_Generate_FullMethodName     = "/license.v1.LicenseService/Generate"
+	LicenseService_Renew_FullMethodName        = "/license.v1.LicenseService/Renew"
+	LicenseService_Verify_FullMethodName       = "/license.v1.LicenseService/Verify"
+	LicenseService_GetMachineID_FullMethodName = "/license.v1.LicenseService/GetMachineID"
+	LicenseService_Revoke_FullMethodName       = "/license.v1.LicenseService/Revoke"
+	LicenseService_List_FullMethodName         = "/license.v1.LicenseService/List"
+)
+
+// LicenseServiceClient is the client API for LicenseService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// LicenseService exposes the license server operations over gRPC. Generate,
+// Renew, Revoke and List require a client certificate or an API key when
+// authentication is enabled, passed as "x-api-key" or "authorization: Bearer"
+// metadata.
+type LicenseServiceClient interface {
+	// Generate issues a license for a machine and application
+	Generate(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (*GenerateResponse, error)
+	// Renew issues the successor of a license with the expiry extended and
+	// features added, and marks the previous license as superseded
+	Renew(ctx context.Context, in *RenewRequest, opts ...grpc.CallOption) (*RenewResponse, error)
+	// Verify checks a license against a machine and application. A failed
+	// verification is reported in the response, not as an error.
+	Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*VerifyResponse, error)
+	// GetMachineID returns the machine ID of the server
+	GetMachineID(ctx context.Context, in *GetMachineIDRequest, opts ...grpc.CallOption) (*GetMachineIDResponse, error)
+	// Revoke marks an issued license as revoked
+	Revoke(ctx context.Context, in *RevokeRequest, opts ...grpc.CallOption) (*RevokeResponse, error)
+	// List returns the issued licenses, optionally searched by customer data
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+}
+
+type licenseServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLicenseServiceClient(cc grpc.ClientConnInterface) LicenseServiceClient {
+	return &licenseServiceClient{cc}
+}
+
+func (c *licenseServiceClient) Generate(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (*GenerateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GenerateResponse)
+	err := c.cc.Invoke(ctx, LicenseService_Generate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *licenseServiceClient) Renew(ctx context.Context, in *RenewRequest, opts ...grpc.CallOption) (*RenewResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RenewResponse)
+	err := c.cc.Invoke(ctx, LicenseService_Renew_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *licenseServiceClient) Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*VerifyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VerifyResponse)
+	err := c.cc.Invoke(ctx, LicenseService_Verify_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *licenseServiceClient) GetMachineID(ctx context.Context, in *GetMachineIDRequest, opts ...grpc.CallOption) (*GetMachineIDResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetMachineIDResponse)
+	err := c.cc.Invoke(ctx, LicenseService_GetMachineID_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *licenseServiceClient) Revoke(ctx context.Context, in *RevokeRequest, opts ...grpc.CallOption) (*RevokeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RevokeResponse)
+	err := c.cc.Invoke(ctx, LicenseService_Revoke_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *licenseServiceClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, LicenseService_List_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LicenseServiceServer is the server API for LicenseService service.
+// All implementations must embed UnimplementedLicenseServiceServer
+// for forward compatibility
+//
+// LicenseService exposes the license server operations over gRPC. Generate,
+// Renew, Revoke and List require a client certificate or an API key when
+// authentication is enabled, passed as "x-api-key" or "authorization: Bearer"
+// metadata.
+type LicenseServiceServer interface {
+	// Generate issues a license for a machine and application
+	Generate(context.Context, *GenerateRequest) (*GenerateResponse, error)
+	// Renew issues the successor of a license with the expiry extended and
+	// features added, and marks the previous license as superseded
+	Renew(context.Context, *RenewRequest) (*RenewResponse, error)
+	// Verify checks a license against a machine and application. A failed
+	// verification is reported in the response, not as an error.
+	Verify(context.Context, *VerifyRequest) (*VerifyResponse, error)
+	// GetMachineID returns the machine ID of the server
+	GetMachineID(context.Context, *GetMachineIDRequest) (*GetMachineIDResponse, error)
+	// Revoke marks an issued license as revoked
+	Revoke(context.Context, *RevokeRequest) (*RevokeResponse, error)
+	// List returns the issued licenses, optionally searched by customer data
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	mustEmbedUnimplementedLicenseServiceServer()
+}
+
+// UnimplementedLicenseServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedLicenseServiceServer struct {
+}
+
+func (UnimplementedLicenseServiceServer) Generate(context.Context, *GenerateRequest) (*GenerateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Generate not implemented")
+}
+func (UnimplementedLicenseServiceServer) Renew(context.Context, *RenewRequest) (*RenewResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Renew not implemented")
+}
+func (UnimplementedLicenseServiceServer) Verify(context.Context, *VerifyRequest) (*VerifyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (UnimplementedLicenseServiceServer) GetMachineID(context.Context, *GetMachineIDRequest) (*GetMachineIDResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMachineID not implemented")
+}
+func (UnimplementedLicenseServiceServer) Revoke(context.Context, *RevokeRequest) (*RevokeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Revoke not implemented")
+}
+func (UnimplementedLicenseServiceServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedLicenseServiceServer) mustEmbedUnimplementedLicenseServiceServer() {}
+
+// UnsafeLicenseServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LicenseServiceServer will
+// result in compilation errors.
+type UnsafeLicenseServiceServer interface {
+	mustEmbedUnimplementedLicenseServiceServer()
+}
+
+func RegisterLicenseServiceServer(s grpc.ServiceRegistrar, srv LicenseServiceServer) {
+	s.RegisterService(&LicenseService_ServiceDesc, srv)
+}
+
+func _LicenseService_Generate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GenerateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LicenseServiceServer).Generate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LicenseService_Generate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LicenseServiceServer).Generate(ctx, req.(*GenerateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LicenseService_Renew_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LicenseServiceServer).Renew(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LicenseService_Renew_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LicenseServiceServer).Renew(ctx, req.(*RenewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LicenseService_Verify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LicenseServiceServer).Verify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LicenseService_Verify_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LicenseServiceServer).Verify(ctx, req.(*VerifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LicenseService_GetMachineID_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMachineIDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LicenseServiceServer).GetMachineID(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LicenseService_GetMachineID_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LicenseServiceServer).GetMachineID(ctx, req.(*GetMachineIDRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LicenseService_Revoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LicenseServiceServer).Revoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LicenseService_Revoke_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LicenseServiceServer).Revoke(ctx, req.(*RevokeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LicenseService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LicenseServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LicenseService_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LicenseServiceServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// LicenseService_ServiceDesc is the grpc.ServiceDesc for LicenseService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LicenseService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "license.v1.LicenseService",
+	HandlerType: (*LicenseServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Generate",
+			Handler:    _LicenseService_Generate_Handler,
+		},
+		{
+			MethodName: "Renew",
+			Handler:    _LicenseService_Renew_Handler,
+		},
+		{
+			MethodName: "Verify",
+			Handler:    _LicenseService_Verify_Handler,
+		},
+		{
+			MethodName: "GetMachineID",
+			Handler:    _LicenseService_GetMachineID_Handler,
+		},
+		{
+			MethodName: "Revoke",
+			Handler:    _LicenseService_Revoke_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _LicenseService_List_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "license/v1/license.proto",
+}